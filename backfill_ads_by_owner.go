@@ -0,0 +1,14 @@
+package main
+
+import (
+	"context"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/FTN-TwitterClone/ads/service"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// backfillAdsByOwner runs `main backfill-ads-by-owner` once ads_by_owner is created, ads saved before it existed aren't
+// listed for their advertiser until then.
+func backfillAdsByOwner(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository) error {
+	return service.BackfillAdsByOwner(ctx, tracer, eventsRepository)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/FTN-TwitterClone/ads/service"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// backfillTouchpoints runs `main backfill-touchpoints` once viewer_touchpoints is created, conversions ingested
+// before it finished can have missed earlier contact with the ad.
+func backfillTouchpoints(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository) error {
+	err := service.BackfillTouchpoints(ctx, tracer, eventsRepository)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("conversions ingested before the touchpoints were backfilled can be missing their attribution, run rebuild-reports over the days since the deploy to recount them")
+
+	return nil
+}
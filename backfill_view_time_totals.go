@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/FTN-TwitterClone/ads/service"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const viewTimeTotalsMigration = "view_time_totals"
+
+// backfillViewTimeTotals runs `main backfill-view-time-totals --cutoff <RFC 3339 time>` once the deploy that started
+// counting view time totals is done. The cutoff is when its first instance started, it's saved by the first run and
+// later runs must pass the same one.
+func backfillViewTimeTotals(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, args []string) error {
+	flags := flag.NewFlagSet("backfill-view-time-totals", flag.ExitOnError)
+	cutoffFlag := flags.String("cutoff", "", "when the first instance counting view time totals started, RFC 3339")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *cutoffFlag == "" {
+		return errors.New("--cutoff is required")
+	}
+
+	cutoff, err := time.Parse(time.RFC3339, *cutoffFlag)
+	if err != nil {
+		return err
+	}
+
+	// stored with millisecond precision
+	cutoff = cutoff.Truncate(time.Millisecond)
+
+	saved, err := reportsRepository.SaveMigrationCutoff(ctx, viewTimeTotalsMigration, cutoff)
+	if err != nil {
+		return err
+	}
+
+	if !saved.Equal(cutoff) {
+		return fmt.Errorf("the cutoff was saved as %s by an earlier run", saved.Format(time.RFC3339))
+	}
+
+	err = service.BackfillViewTimeTotals(ctx, tracer, eventsRepository, reportsRepository, cutoff)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("views taken by the old code after %s aren't in the totals, run reconcile-reports --repair with --days covering the deploy once its days are over\n", cutoff.Format(time.RFC3339))
+
+	return nil
+}
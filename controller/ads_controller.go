@@ -2,6 +2,7 @@ package controller
 
 import (
 	"fmt"
+	"github.com/FTN-TwitterClone/ads/controller/export"
 	"github.com/FTN-TwitterClone/ads/controller/json"
 	"github.com/FTN-TwitterClone/ads/model"
 	"github.com/FTN-TwitterClone/ads/service"
@@ -9,8 +10,10 @@ import (
 	"github.com/gorilla/mux"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type AdsController struct {
@@ -49,13 +52,264 @@ func (c *AdsController) GetAdInfo(w http.ResponseWriter, req *http.Request) {
 	json.EncodeJson(w, &adInfo)
 }
 
+func (c *AdsController) GetAds(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.GetAds")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	limit := 0
+	if l := req.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			http.Error(w, "Invalid limit", 400)
+			return
+		}
+	}
+
+	page, appErr := c.adsService.GetAds(ctx, req.URL.Query().Get("sort"), limit, req.URL.Query().Get("cursor"))
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, page)
+}
+
+func (c *AdsController) SetAdTimezone(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.SetAdTimezone")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	timezone, err := json.DecodeJson[model.AdTimezone](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	appErr := c.adsService.SetAdTimezone(ctx, tweetId, timezone)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+}
+
+func (c *AdsController) SetAdSchedule(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.SetAdSchedule")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	schedule, err := json.DecodeJson[model.AdSchedule](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	appErr := c.adsService.SetAdSchedule(ctx, tweetId, schedule)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+}
+
+func (c *AdsController) GetAdScheduleHistory(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.GetAdScheduleHistory")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	history, appErr := c.adsService.GetAdScheduleHistory(ctx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, history)
+}
+
+func (c *AdsController) SetAdStatus(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.SetAdStatus")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	status, err := json.DecodeJson[model.AdStatus](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	appErr := c.adsService.SetAdStatus(ctx, tweetId, status)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+}
+
+func (c *AdsController) GetAdStatusHistory(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.GetAdStatusHistory")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	history, appErr := c.adsService.GetAdStatusHistory(ctx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, history)
+}
+
+func (c *AdsController) SetAdTargeting(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.SetAdTargeting")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	targeting, err := json.DecodeJson[model.AdTargeting](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	appErr := c.adsService.SetAdTargeting(ctx, tweetId, targeting)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+}
+
+func (c *AdsController) GetAdTargetingHistory(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.GetAdTargetingHistory")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	history, appErr := c.adsService.GetAdTargetingHistory(ctx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, history)
+}
+
+func (c *AdsController) DeleteAd(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.DeleteAd")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	appErr := c.adsService.DeleteAd(ctx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+}
+
 func (c *AdsController) AddProfileVisitedEvent(w http.ResponseWriter, req *http.Request) {
 	ctx, span := c.tracer.Start(req.Context(), "AdsController.AddProfileVisitedEvent")
 	defer span.End()
 
 	tweetId := mux.Vars(req)["tweetId"]
 
-	appErr := c.adsService.AddProfileVisitedEvent(ctx, tweetId)
+	// the body is optional, visits sent without one happened now
+	occurrence, err := json.DecodeJson[model.EventTime](req.Body)
+	if err != nil && err != io.EOF {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	appErr := c.adsService.AddProfileVisitedEvent(ctx, tweetId, occurrence, req.Header.Get("Idempotency-Key"))
 	if appErr != nil {
 		span.SetStatus(codes.Error, appErr.Error())
 		http.Error(w, appErr.Message, appErr.Code)
@@ -76,7 +330,28 @@ func (c *AdsController) AddTweetViewedEvent(w http.ResponseWriter, req *http.Req
 		return
 	}
 
-	appErr := c.adsService.AddTweetViewedEvent(ctx, tweetId, viewTime)
+	appErr := c.adsService.AddTweetViewedEvent(ctx, tweetId, viewTime, req.Header.Get("Idempotency-Key"))
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+}
+
+func (c *AdsController) AddTweetClickedEvent(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.AddTweetClickedEvent")
+	defer span.End()
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	click, err := json.DecodeJson[model.TweetClick](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	appErr := c.adsService.AddTweetClickedEvent(ctx, tweetId, click, req.Header.Get("Idempotency-Key"))
 	if appErr != nil {
 		span.SetStatus(codes.Error, appErr.Error())
 		http.Error(w, appErr.Message, appErr.Code)
@@ -84,6 +359,27 @@ func (c *AdsController) AddTweetViewedEvent(w http.ResponseWriter, req *http.Req
 	}
 }
 
+func (c *AdsController) AddEvents(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.AddEvents")
+	defer span.End()
+
+	events, err := json.DecodeJson[[]model.BatchEvent](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	results, appErr := c.adsService.AddEvents(ctx, events)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, results)
+}
+
 func (c *AdsController) GetMonthlyReport(w http.ResponseWriter, req *http.Request) {
 	ctx, span := c.tracer.Start(req.Context(), "AdsController.GetMonthlyReport")
 	defer span.End()
@@ -126,6 +422,14 @@ func (c *AdsController) GetMonthlyReport(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	if format := export.Format(req); format != "" {
+		err = export.WriteReports(w, format, fmt.Sprintf("report-%s-%d-%02d", tweetId, year, month), []model.Report{*report})
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return
+	}
+
 	json.EncodeJson(w, &report)
 }
 
@@ -178,5 +482,262 @@ func (c *AdsController) GetDailyReport(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	if format := export.Format(req); format != "" {
+		err = export.WriteReports(w, format, fmt.Sprintf("report-%s-%d-%02d-%02d", tweetId, year, month, day), []model.Report{*report})
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return
+	}
+
+	json.EncodeJson(w, &report)
+}
+
+func (c *AdsController) GetHourlyReport(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.GetHourlyReport")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetIdString := mux.Vars(req)["tweetId"]
+
+	year, err := strconv.ParseInt(mux.Vars(req)["year"], 10, 64)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "", 500)
+		return
+	}
+
+	month, err := strconv.ParseInt(mux.Vars(req)["month"], 10, 64)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "", 500)
+		return
+	}
+
+	day, err := strconv.ParseInt(mux.Vars(req)["day"], 10, 64)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "", 500)
+		return
+	}
+
+	hour, err := strconv.ParseInt(mux.Vars(req)["hour"], 10, 64)
+	if err != nil || hour < 0 || hour > 23 {
+		span.SetStatus(codes.Error, "Invalid hour")
+		http.Error(w, "Invalid hour", 400)
+		return
+	}
+
+	tweetId, err := gocql.ParseUUID(tweetIdString)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "", 500)
+		return
+	}
+
+	report, appErr := c.adsService.GetHourlyReport(ctx, tweetId.String(), year, month, day, hour)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	if format := export.Format(req); format != "" {
+		err = export.WriteReports(w, format, fmt.Sprintf("report-%s-%d-%02d-%02d-%02d", tweetId, year, month, day, hour), []model.Report{*report})
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return
+	}
+
 	json.EncodeJson(w, &report)
 }
+
+func (c *AdsController) GetRangeReport(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.GetRangeReport")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	from, err := time.Parse("2006-01-02", req.URL.Query().Get("from"))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid from date", 400)
+		return
+	}
+
+	to, err := time.Parse("2006-01-02", req.URL.Query().Get("to"))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid to date", 400)
+		return
+	}
+
+	report, appErr := c.adsService.GetRangeReport(ctx, tweetId, from, to)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	if format := export.Format(req); format != "" {
+		err = export.WriteReports(w, format, fmt.Sprintf("report-%s-%s-%s", tweetId, report.From, report.To), []model.Report{*report})
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return
+	}
+
+	json.EncodeJson(w, &report)
+}
+
+func (c *AdsController) GetReportSeries(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.GetReportSeries")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	from, err := time.Parse("2006-01-02", req.URL.Query().Get("from"))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid from date", 400)
+		return
+	}
+
+	to, err := time.Parse("2006-01-02", req.URL.Query().Get("to"))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid to date", 400)
+		return
+	}
+
+	granularity := req.URL.Query().Get("granularity")
+	if granularity == "" {
+		granularity = model.DAY
+	}
+
+	series, appErr := c.adsService.GetReportSeries(ctx, tweetId, from, to, granularity)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	if format := export.Format(req); format != "" {
+		err = export.WriteReports(w, format, fmt.Sprintf("report-%s-%s-%s-%s", tweetId, series.From, series.To, granularity), series.Points)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return
+	}
+
+	json.EncodeJson(w, &series)
+}
+
+func (c *AdsController) GetAdSummary(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.GetAdSummary")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	from, err := time.Parse("2006-01-02", req.URL.Query().Get("from"))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid from date", 400)
+		return
+	}
+
+	to, err := time.Parse("2006-01-02", req.URL.Query().Get("to"))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid to date", 400)
+		return
+	}
+
+	summary, appErr := c.adsService.GetAdSummary(ctx, tweetId, from, to)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	if export.WantsPdf(req) {
+		err = export.WriteAdSummary(w, fmt.Sprintf("summary-%s-%s-%s", tweetId, summary.From, summary.To), summary)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			http.Error(w, "", 500)
+		}
+		return
+	}
+
+	json.EncodeJson(w, &summary)
+}
+
+func (c *AdsController) GetAudienceBreakdown(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdsController.GetAudienceBreakdown")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	tweetId := mux.Vars(req)["tweetId"]
+
+	from, err := time.Parse("2006-01-02", req.URL.Query().Get("from"))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid from date", 400)
+		return
+	}
+
+	to, err := time.Parse("2006-01-02", req.URL.Query().Get("to"))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "Invalid to date", 400)
+		return
+	}
+
+	breakdown, appErr := c.adsService.GetAudienceBreakdown(ctx, tweetId, from, to)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, &breakdown)
+}
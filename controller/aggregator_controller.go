@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"github.com/FTN-TwitterClone/ads/controller/json"
+	"github.com/FTN-TwitterClone/ads/service"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+type AggregatorController struct {
+	aggregator *service.ReportAggregator
+	tracer     trace.Tracer
+}
+
+func NewAggregatorController(aggregator *service.ReportAggregator, tracer trace.Tracer) *AggregatorController {
+	return &AggregatorController{
+		aggregator,
+		tracer,
+	}
+}
+
+func (c *AggregatorController) GetStats(w http.ResponseWriter, req *http.Request) {
+	_, span := c.tracer.Start(req.Context(), "AggregatorController.GetStats")
+	defer span.End()
+
+	json.EncodeJson(w, c.aggregator.Stats())
+}
@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/controller/json"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/service"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+)
+
+type CampaignsController struct {
+	campaignsService *service.CampaignsService
+	tracer           trace.Tracer
+}
+
+func NewCampaignsController(campaignsService *service.CampaignsService, tracer trace.Tracer) *CampaignsController {
+	return &CampaignsController{
+		campaignsService,
+		tracer,
+	}
+}
+
+func (c *CampaignsController) CreateCampaign(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "CampaignsController.CreateCampaign")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	campaign, err := json.DecodeJson[model.Campaign](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	created, appErr := c.campaignsService.CreateCampaign(ctx, campaign)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	w.WriteHeader(201)
+	json.EncodeJson(w, created)
+}
+
+func (c *CampaignsController) GetCampaigns(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "CampaignsController.GetCampaigns")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	campaigns, appErr := c.campaignsService.GetCampaigns(ctx)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, campaigns)
+}
+
+func (c *CampaignsController) GetCampaign(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "CampaignsController.GetCampaign")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	campaignId := mux.Vars(req)["campaignId"]
+
+	campaign, appErr := c.campaignsService.GetCampaign(ctx, campaignId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, campaign)
+}
+
+func (c *CampaignsController) UpdateCampaign(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "CampaignsController.UpdateCampaign")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	campaignId := mux.Vars(req)["campaignId"]
+
+	campaign, err := json.DecodeJson[model.Campaign](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	updated, appErr := c.campaignsService.UpdateCampaign(ctx, campaignId, campaign)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, updated)
+}
+
+func (c *CampaignsController) DeleteCampaign(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "CampaignsController.DeleteCampaign")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	campaignId := mux.Vars(req)["campaignId"]
+
+	appErr := c.campaignsService.DeleteCampaign(ctx, campaignId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+}
+
+func (c *CampaignsController) AddCampaignAd(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "CampaignsController.AddCampaignAd")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	campaignId := mux.Vars(req)["campaignId"]
+	tweetId := mux.Vars(req)["tweetId"]
+
+	appErr := c.campaignsService.AddCampaignAd(ctx, campaignId, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+}
+
+func (c *CampaignsController) RemoveCampaignAd(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "CampaignsController.RemoveCampaignAd")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	campaignId := mux.Vars(req)["campaignId"]
+	tweetId := mux.Vars(req)["tweetId"]
+
+	appErr := c.campaignsService.RemoveCampaignAd(ctx, campaignId, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+}
+
+func (c *CampaignsController) GetCampaignMonthlyReport(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "CampaignsController.GetCampaignMonthlyReport")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	campaignId := mux.Vars(req)["campaignId"]
+
+	year, err := strconv.ParseInt(mux.Vars(req)["year"], 10, 64)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "", 500)
+		return
+	}
+
+	month, err := strconv.ParseInt(mux.Vars(req)["month"], 10, 64)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "", 500)
+		return
+	}
+
+	report, appErr := c.campaignsService.GetCampaignMonthlyReport(ctx, campaignId, year, month)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, report)
+}
+
+func (c *CampaignsController) GetCampaignDailyReport(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "CampaignsController.GetCampaignDailyReport")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	if authUser.Role != "ROLE_BUSINESS" {
+		span.SetStatus(codes.Error, fmt.Sprintf("%s not allowed!", authUser.Role))
+		http.Error(w, "", 403)
+		return
+	}
+
+	campaignId := mux.Vars(req)["campaignId"]
+
+	year, err := strconv.ParseInt(mux.Vars(req)["year"], 10, 64)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "", 500)
+		return
+	}
+
+	month, err := strconv.ParseInt(mux.Vars(req)["month"], 10, 64)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "", 500)
+		return
+	}
+
+	day, err := strconv.ParseInt(mux.Vars(req)["day"], 10, 64)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, "", 500)
+		return
+	}
+
+	report, appErr := c.campaignsService.GetCampaignDailyReport(ctx, campaignId, year, month, day)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, report)
+}
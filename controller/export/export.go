@@ -0,0 +1,248 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/model"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+
+	csvContentType  = "text/csv"
+	xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+type column struct {
+	header string
+	value  func(r *model.Report) float64
+}
+
+var columns = []column{
+	{"year", func(r *model.Report) float64 { return float64(r.Year) }},
+	{"month", func(r *model.Report) float64 { return float64(r.Month) }},
+	{"day", func(r *model.Report) float64 { return float64(r.Day) }},
+	{"hour", func(r *model.Report) float64 { return float64(r.Hour) }},
+	{"likesCount", func(r *model.Report) float64 { return float64(r.LikesCount) }},
+	{"unlikesCount", func(r *model.Report) float64 { return float64(r.UnlikesCount) }},
+	{"profileVisits", func(r *model.Report) float64 { return float64(r.ProfileVisits) }},
+	{"impressions", func(r *model.Report) float64 { return float64(r.Impressions) }},
+	{"lateEvents", func(r *model.Report) float64 { return float64(r.LateEvents) }},
+	{"inactiveEvents", func(r *model.Report) float64 { return float64(r.InactiveEvents) }},
+	{"activeDays", func(r *model.Report) float64 { return float64(r.ActiveDays) }},
+	{"scheduledHours", func(r *model.Report) float64 { return float64(r.ScheduledHours) }},
+	{"deliveredHours", func(r *model.Report) float64 {
+		if r.DeliveredHours == nil {
+			return math.NaN()
+		}
+		return float64(*r.DeliveredHours)
+	}},
+	{"clicks", func(r *model.Report) float64 { return float64(r.Clicks) }},
+	{"linkClicks", func(r *model.Report) float64 { return float64(r.LinkClicks) }},
+	{"mediaClicks", func(r *model.Report) float64 { return float64(r.MediaClicks) }},
+	{"hashtagClicks", func(r *model.Report) float64 { return float64(r.HashtagClicks) }},
+	{"conversions", func(r *model.Report) float64 { return float64(r.Conversions) }},
+	{"retweets", func(r *model.Report) float64 { return float64(r.Retweets) }},
+	{"replies", func(r *model.Report) float64 { return float64(r.Replies) }},
+	{"follows", func(r *model.Report) float64 { return float64(r.Follows) }},
+	{"attributedConversions", func(r *model.Report) float64 { return float64(r.AttributedConversions) }},
+	{"organicConversions", func(r *model.Report) float64 { return float64(r.OrganicConversions) }},
+	{"averageViewTime", func(r *model.Report) float64 { return float64(r.AverageViewTime) }},
+	{"viewTimeMedian", func(r *model.Report) float64 { return float64(r.ViewTimeMedian) }},
+	{"viewTimeP90", func(r *model.Report) float64 { return float64(r.ViewTimeP90) }},
+	{"viewTimeP99", func(r *model.Report) float64 { return float64(r.ViewTimeP99) }},
+	{"uniqueViewers", func(r *model.Report) float64 { return float64(r.UniqueViewers) }},
+	{"uniqueProfileVisitors", func(r *model.Report) float64 { return float64(r.UniqueProfileVisitors) }},
+	{"uniqueLikers", func(r *model.Report) float64 { return float64(r.UniqueLikers) }},
+	{"netLikes", func(r *model.Report) float64 { return float64(r.NetLikes) }},
+	{"engagementRate", func(r *model.Report) float64 { return r.EngagementRate }},
+	{"profileVisitRate", func(r *model.Report) float64 { return r.ProfileVisitRate }},
+	{"clickThroughRate", func(r *model.Report) float64 { return r.ClickThroughRate }},
+	{"conversionRate", func(r *model.Report) float64 { return r.ConversionRate }},
+}
+
+// Format picks the export format from the format query parameter or the Accept header, "" means JSON.
+func Format(req *http.Request) string {
+	switch strings.ToLower(req.URL.Query().Get("format")) {
+	case CSV:
+		return CSV
+	case XLSX:
+		return XLSX
+	}
+
+	accept := req.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, csvContentType):
+		return CSV
+	case strings.Contains(accept, xlsxContentType):
+		return XLSX
+	}
+
+	return ""
+}
+
+// WriteReports writes reports as a downloadable file named filename with the extension of the format.
+func WriteReports(w http.ResponseWriter, format string, filename string, reports []model.Report) error {
+	switch format {
+	case CSV:
+		setAttachmentHeaders(w, csvContentType, filename+".csv")
+		return writeCsv(w, reports)
+	case XLSX:
+		setAttachmentHeaders(w, xlsxContentType, filename+".xlsx")
+		return writeXlsx(w, reports)
+	default:
+		return fmt.Errorf("unsupported format %s", format)
+	}
+}
+
+func setAttachmentHeaders(w http.ResponseWriter, contentType string, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
+
+func writeCsv(w io.Writer, reports []model.Report) error {
+	cw := csv.NewWriter(w)
+
+	record := make([]string, len(columns)+1)
+	record[0] = "tweetId"
+	for i, c := range columns {
+		record[i+1] = c.header
+	}
+	cw.Write(record)
+
+	for i := range reports {
+		record[0] = reports[i].TweetId
+		for j, c := range columns {
+			record[j+1] = formatValue(c.value(&reports[i]))
+		}
+		cw.Write(record)
+
+		// flush regularly so long ranges reach the client while they are written
+		if i%100 == 99 {
+			cw.Flush()
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeXlsx(w io.Writer, reports []model.Report) error {
+	zw := zip.NewWriter(w)
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Report" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+	}
+
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return err
+	}
+
+	header := make([]string, len(columns)+1)
+	header[0] = "tweetId"
+	for i, c := range columns {
+		header[i+1] = c.header
+	}
+	if err := writeXlsxRow(sheet, header, nil); err != nil {
+		return err
+	}
+
+	values := make([]float64, len(columns))
+	for i := range reports {
+		for j, c := range columns {
+			values[j] = c.value(&reports[i])
+		}
+		if err := writeXlsxRow(sheet, []string{reports[i].TweetId}, values); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(sheet, `</sheetData></worksheet>`)
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// formatValue formats a column value, values that aren't known are left empty.
+func formatValue(v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// writeXlsxRow writes a row of text cells followed by number cells, values that aren't known are left empty.
+func writeXlsxRow(w io.Writer, texts []string, values []float64) error {
+	if _, err := io.WriteString(w, `<row>`); err != nil {
+		return err
+	}
+
+	for _, s := range texts {
+		if err := writeXlsxString(w, s); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range values {
+		var err error
+		if math.IsNaN(v) {
+			_, err = io.WriteString(w, `<c/>`)
+		} else {
+			_, err = fmt.Fprintf(w, `<c><v>%s</v></c>`, formatValue(v))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, `</row>`)
+	return err
+}
+
+func writeXlsxString(w io.Writer, s string) error {
+	if _, err := io.WriteString(w, `<c t="inlineStr"><is><t>`); err != nil {
+		return err
+	}
+	if err := xml.EscapeText(w, []byte(s)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, `</t></is></c>`)
+	return err
+}
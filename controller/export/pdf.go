@@ -0,0 +1,263 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/model"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	pdfContentType = "application/pdf"
+
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 40.0
+)
+
+// WantsPdf reports whether a PDF was asked for with ?format=pdf or the Accept header.
+func WantsPdf(req *http.Request) bool {
+	if strings.ToLower(req.URL.Query().Get("format")) == "pdf" {
+		return true
+	}
+
+	return strings.Contains(req.Header.Get("Accept"), pdfContentType)
+}
+
+// WriteAdSummary renders the summary of an ad as a PDF attachment named filename.pdf.
+func WriteAdSummary(w http.ResponseWriter, filename string, summary *model.AdSummary) error {
+	var buf bytes.Buffer
+
+	d := newPdfDocument()
+	d.drawAdSummary(summary)
+
+	err := d.writeTo(&buf)
+	if err != nil {
+		return err
+	}
+
+	setAttachmentHeaders(w, pdfContentType, filename+".pdf")
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func (d *pdfDocument) drawAdSummary(s *model.AdSummary) {
+	a := s.AdInfo
+
+	d.text(margin, d.y, 18, "Campaign summary")
+	d.y -= 22
+	d.text(margin, d.y, 10, fmt.Sprintf("Promoted tweet %s by %s", a.TweetId, a.PostedBy))
+	d.y -= 14
+	d.text(margin, d.y, 10, fmt.Sprintf("Period %s to %s, generated %s", s.From, s.To, time.Now().Format("2006-01-02 15:04")))
+	d.y -= 28
+
+	d.heading("Targeting")
+	d.table([]float64{120, 200}, [][]string{
+		{"Town", orDash(a.Town)},
+		{"Age", fmt.Sprintf("%d - %d", a.MinAge, a.MaxAge)},
+		{"Gender", orDash(a.Gender)},
+	})
+	d.y -= 16
+
+	d.heading("Totals")
+	d.table([]float64{120, 200}, [][]string{
+		{"Likes", fmt.Sprint(s.Total.LikesCount)},
+		{"Unlikes", fmt.Sprint(s.Total.UnlikesCount)},
+		{"Net likes", fmt.Sprint(s.Total.NetLikes)},
+		{"Profile visits", fmt.Sprint(s.Total.ProfileVisits)},
+		{"Impressions", fmt.Sprint(s.Total.Impressions)},
+		{"Engagement rate", fmt.Sprintf("%.2f%%", s.Total.EngagementRate*100)},
+		{"Profile visit rate", fmt.Sprintf("%.2f%%", s.Total.ProfileVisitRate*100)},
+		{"Clicks", fmt.Sprint(s.Total.Clicks)},
+		{"Click-through rate", fmt.Sprintf("%.2f%%", s.Total.ClickThroughRate*100)},
+		{"Conversions", fmt.Sprint(s.Total.Conversions)},
+		{"Conversion rate", fmt.Sprintf("%.2f%%", s.Total.ConversionRate*100)},
+		{"Attributed conversions", fmt.Sprint(s.Total.AttributedConversions)},
+		{"Organic conversions", fmt.Sprint(s.Total.OrganicConversions)},
+		{"Average view time", fmt.Sprint(s.Total.AverageViewTime)},
+		{"Median view time", fmt.Sprint(s.Total.ViewTimeMedian)},
+		{"90th percentile view time", fmt.Sprint(s.Total.ViewTimeP90)},
+		{"99th percentile view time", fmt.Sprint(s.Total.ViewTimeP99)},
+		{"Unique viewers", fmt.Sprint(s.Total.UniqueViewers)},
+		{"Unique profile visitors", fmt.Sprint(s.Total.UniqueProfileVisitors)},
+		{"Unique likers", fmt.Sprint(s.Total.UniqueLikers)},
+	})
+	d.y -= 16
+
+	d.barChart("Likes per day", s.Daily, func(r *model.Report) float64 { return float64(r.LikesCount) })
+	d.barChart("Profile visits per day", s.Daily, func(r *model.Report) float64 { return float64(r.ProfileVisits) })
+	d.barChart("Average view time per day", s.Daily, func(r *model.Report) float64 { return float64(r.AverageViewTime) })
+
+	d.heading("Monthly figures")
+	rows := [][]string{{"Month", "Likes", "Unlikes", "Profile visits", "Avg view time"}}
+	for _, r := range s.Monthly {
+		rows = append(rows, []string{
+			fmt.Sprintf("%d-%02d", r.Year, r.Month),
+			fmt.Sprint(r.LikesCount),
+			fmt.Sprint(r.UnlikesCount),
+			fmt.Sprint(r.ProfileVisits),
+			fmt.Sprint(r.AverageViewTime),
+		})
+	}
+	d.table([]float64{100, 100, 100, 100, 100}, rows)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// pdfDocument is a minimal PDF 1.4 writer using the standard Helvetica font, enough for text, tables and bar charts.
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func newPdfDocument() *pdfDocument {
+	d := &pdfDocument{}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDocument) newPage() {
+	d.page = new(bytes.Buffer)
+	d.pages = append(d.pages, d.page)
+	d.y = pageHeight - margin - 18
+}
+
+// ensure starts a new page when less than height is left on the current one.
+func (d *pdfDocument) ensure(height float64) {
+	if d.y-height < margin {
+		d.newPage()
+	}
+}
+
+func (d *pdfDocument) text(x float64, y float64, size float64, s string) {
+	fmt.Fprintf(d.page, "BT /F1 %.1f Tf %.2f %.2f Td (%s) Tj ET\n", size, x, y, escapePdfText(s))
+}
+
+func (d *pdfDocument) rect(x float64, y float64, w float64, h float64, gray float64) {
+	fmt.Fprintf(d.page, "%.2f g %.2f %.2f %.2f %.2f re f 0 g\n", gray, x, y, w, h)
+}
+
+func (d *pdfDocument) line(x1 float64, y1 float64, x2 float64, y2 float64) {
+	fmt.Fprintf(d.page, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+func (d *pdfDocument) heading(s string) {
+	d.ensure(40)
+	d.text(margin, d.y, 13, s)
+	d.y -= 18
+}
+
+func (d *pdfDocument) table(widths []float64, rows [][]string) {
+	const rowHeight = 16.0
+
+	for _, row := range rows {
+		d.ensure(rowHeight)
+
+		x := margin
+		for i, cell := range row {
+			d.text(x+4, d.y-11, 10, cell)
+			x += widths[i]
+		}
+		d.line(margin, d.y-rowHeight, x, d.y-rowHeight)
+
+		d.y -= rowHeight
+	}
+}
+
+func (d *pdfDocument) barChart(title string, reports []model.Report, value func(r *model.Report) float64) {
+	const chartHeight = 100.0
+	chartWidth := pageWidth - 2*margin
+
+	d.ensure(chartHeight + 40)
+	d.heading(title)
+
+	max := 0.0
+	for i := range reports {
+		if v := value(&reports[i]); v > max {
+			max = v
+		}
+	}
+
+	bottom := d.y - chartHeight
+	d.line(margin, bottom, margin+chartWidth, bottom)
+	d.text(margin+chartWidth-60, d.y+4, 8, fmt.Sprintf("max %.0f", max))
+
+	if len(reports) > 0 && max > 0 {
+		slot := chartWidth / float64(len(reports))
+		for i := range reports {
+			h := value(&reports[i]) / max * chartHeight
+			d.rect(margin+float64(i)*slot+slot*0.1, bottom, slot*0.8, h, 0.4)
+		}
+	}
+
+	if len(reports) > 0 {
+		first, last := reports[0], reports[len(reports)-1]
+		d.text(margin, bottom-10, 8, fmt.Sprintf("%d-%02d-%02d", first.Year, first.Month, first.Day))
+		d.text(margin+chartWidth-45, bottom-10, 8, fmt.Sprintf("%d-%02d-%02d", last.Year, last.Month, last.Day))
+	}
+
+	d.y = bottom - 28
+}
+
+func (d *pdfDocument) writeTo(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// 1 catalog, 2 page tree, 3 font, then a page and its content stream for every page
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+
+	for i, p := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.Len(), p.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// escapePdfText escapes string delimiters and replaces characters Helvetica can't show with WinAnsiEncoding.
+func escapePdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 255:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
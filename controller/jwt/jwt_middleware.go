@@ -34,6 +34,17 @@ func ExtractJWTUserMiddleware(tracer trace.Tracer) mux.MiddlewareFunc {
 						Exp:      time.UnixMilli(int64(claims["exp"].(float64))),
 					}
 
+					// profile claims are optional, tokens without them just leave the demographics unknown
+					if age, ok := claims["age"].(float64); ok {
+						authUser.Demographics.Age = int32(age)
+					}
+					if gender, ok := claims["gender"].(string); ok {
+						authUser.Demographics.Gender = gender
+					}
+					if town, ok := claims["town"].(string); ok {
+						authUser.Demographics.Town = town
+					}
+
 					authCtx := context.WithValue(newCtx, "authUser", authUser)
 
 					next.ServeHTTP(w, r.WithContext(authCtx))
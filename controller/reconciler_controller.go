@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"github.com/FTN-TwitterClone/ads/controller/json"
+	"github.com/FTN-TwitterClone/ads/service"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+type ReconcilerController struct {
+	reconciler *service.ReportReconciler
+	tracer     trace.Tracer
+}
+
+func NewReconcilerController(reconciler *service.ReportReconciler, tracer trace.Tracer) *ReconcilerController {
+	return &ReconcilerController{
+		reconciler,
+		tracer,
+	}
+}
+
+func (c *ReconcilerController) GetStats(w http.ResponseWriter, req *http.Request) {
+	_, span := c.tracer.Start(req.Context(), "ReconcilerController.GetStats")
+	defer span.End()
+
+	json.EncodeJson(w, c.reconciler.Stats())
+}
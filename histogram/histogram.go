@@ -0,0 +1,96 @@
+package histogram
+
+import (
+	"math"
+	"strconv"
+)
+
+// bounds are the exclusive upper bounds of the buckets, following a 1-2-5 series so every bucket spans at most 2.5x
+var bounds = func() []int64 {
+	var b []int64
+	for decade := int64(1); decade <= 1_000_000_000; decade *= 10 {
+		b = append(b, decade, 2*decade, 5*decade)
+	}
+	return append(b, math.MaxInt64)
+}()
+
+// Counts is a sparse histogram keyed by bucket index, so it can be stored in a document and updated with $inc.
+type Counts map[string]int64
+
+type Bucket struct {
+	From  int64 `json:"from"`
+	To    int64 `json:"to"`
+	Count int64 `json:"count"`
+}
+
+// Key returns the index (as a document key) of the bucket value falls into.
+func Key(value int64) string {
+	for i, b := range bounds {
+		if value < b {
+			return strconv.Itoa(i)
+		}
+	}
+	return strconv.Itoa(len(bounds) - 1)
+}
+
+// Merge returns the sum of histograms.
+func Merge(histograms ...Counts) Counts {
+	merged := Counts{}
+	for _, h := range histograms {
+		for k, v := range h {
+			merged[k] += v
+		}
+	}
+	return merged
+}
+
+// Buckets returns the non-empty buckets in ascending order.
+func (c Counts) Buckets() []Bucket {
+	buckets := []Bucket{}
+	for i := range bounds {
+		count := c[strconv.Itoa(i)]
+		if count == 0 {
+			continue
+		}
+
+		from := int64(0)
+		if i > 0 {
+			from = bounds[i-1]
+		}
+
+		buckets = append(buckets, Bucket{From: from, To: bounds[i], Count: count})
+	}
+	return buckets
+}
+
+// Percentile estimates the value below which p (0-100) percent of the observations fall,
+// interpolating linearly inside the bucket it lands in.
+func (c Counts) Percentile(p float64) int64 {
+	buckets := c.Buckets()
+
+	total := int64(0)
+	for _, b := range buckets {
+		total += b.Count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := p / 100 * float64(total)
+
+	seen := int64(0)
+	for _, b := range buckets {
+		if float64(seen+b.Count) >= rank {
+			to := b.To
+			if to == math.MaxInt64 {
+				return b.From
+			}
+
+			fraction := (rank - float64(seen)) / float64(b.Count)
+			return b.From + int64(math.Round(fraction*float64(to-b.From)))
+		}
+		seen += b.Count
+	}
+
+	return buckets[len(buckets)-1].From
+}
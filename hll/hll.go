@@ -0,0 +1,78 @@
+package hll
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+// Precision is the number of hash bits used to pick a register, 2^12 registers give a standard error of about 1.6%.
+const Precision = 12
+
+const registerCount = 1 << Precision
+
+// Registers is a sparse HyperLogLog sketch keyed by register index, so it can be stored in a document and updated with $max.
+type Registers map[string]int32
+
+// Register returns the register index (as a document key) and the rank value observes.
+func Register(value string) (string, int32) {
+	h := hash(value)
+
+	index := h >> (64 - Precision)
+	rank := bits.LeadingZeros64(h<<Precision|1<<(Precision-1)) + 1
+
+	return strconv.FormatUint(index, 10), int32(rank)
+}
+
+// Merge returns the union of sketches, keeping the highest rank of every register.
+func Merge(sketches ...Registers) Registers {
+	merged := Registers{}
+	for _, s := range sketches {
+		for k, v := range s {
+			if v > merged[k] {
+				merged[k] = v
+			}
+		}
+	}
+	return merged
+}
+
+// Estimate returns the approximate number of distinct values added to the sketch.
+func (r Registers) Estimate() int {
+	if len(r) == 0 {
+		return 0
+	}
+
+	m := float64(registerCount)
+
+	sum := float64(registerCount - len(r))
+	for _, v := range r {
+		sum += math.Pow(2, -float64(v))
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// linear counting is more accurate while many registers are still empty
+	if empty := float64(registerCount - len(r)); estimate <= 2.5*m && empty > 0 {
+		estimate = m * math.Log(m/empty)
+	}
+
+	return int(math.Round(estimate))
+}
+
+func hash(value string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(value))
+	h := f.Sum64()
+
+	// FNV alone spreads short, similar usernames poorly, so finish with the murmur3 mixer
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
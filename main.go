@@ -25,10 +25,11 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 )
 
 func main() {
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	ctx := context.Background()
@@ -55,9 +56,65 @@ func main() {
 		log.Fatal(err)
 	}
 
-	adsService := service.NewAdsService(eventsRepository, reportsRepository, tracer)
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-reports" {
+		err := rebuildReports(ctx, tracer, eventsRepository, reportsRepository, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "backfill-view-time-totals" {
+		err := backfillViewTimeTotals(ctx, tracer, eventsRepository, reportsRepository, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "backfill-ads-by-owner" {
+		err := backfillAdsByOwner(ctx, tracer, eventsRepository)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "backfill-touchpoints" {
+		err := backfillTouchpoints(ctx, tracer, eventsRepository)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "reconcile-reports" {
+		err := reconcileReports(ctx, tracer, eventsRepository, reportsRepository, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	aggregator := service.NewReportAggregator(reportsRepository, tracer)
+
+	reconcileOptions, reconcileInterval := service.ReconcileOptionsFromEnv()
+	reconciler := service.NewReportReconciler(eventsRepository, reportsRepository, tracer, reconcileOptions)
+	if reconcileInterval > 0 {
+		go reconciler.Start(ctx, reconcileInterval)
+	}
+
+	if interval := service.DeadLetterRebuildIntervalFromEnv(); interval > 0 {
+		go service.StartDeadLetterRebuilds(ctx, tracer, eventsRepository, reportsRepository, interval)
+	}
+
+	adsService := service.NewAdsService(eventsRepository, reportsRepository, aggregator, tracer)
+	campaignsService := service.NewCampaignsService(eventsRepository, reportsRepository, tracer)
 
 	adsController := controller.NewAdsController(adsService, tracer)
+	campaignsController := controller.NewCampaignsController(campaignsService, tracer)
+	aggregatorController := controller.NewAggregatorController(aggregator, tracer)
+	reconcilerController := controller.NewReconcilerController(reconciler, tracer)
 
 	router := mux.NewRouter()
 	router.StrictSlash(true)
@@ -66,20 +123,64 @@ func main() {
 		jwt.ExtractJWTUserMiddleware(tracer),
 	)
 
+	router.HandleFunc("/events/", adsController.AddEvents).Methods("POST")
+	router.HandleFunc("/ads/", adsController.GetAds).Methods("GET")
+	router.HandleFunc("/campaigns/", campaignsController.CreateCampaign).Methods("POST")
+	router.HandleFunc("/campaigns/", campaignsController.GetCampaigns).Methods("GET")
+	router.HandleFunc("/campaigns/{campaignId}/", campaignsController.GetCampaign).Methods("GET")
+	router.HandleFunc("/campaigns/{campaignId}/", campaignsController.UpdateCampaign).Methods("PUT")
+	router.HandleFunc("/campaigns/{campaignId}/", campaignsController.DeleteCampaign).Methods("DELETE")
+	router.HandleFunc("/campaigns/{campaignId}/ads/{tweetId}/", campaignsController.AddCampaignAd).Methods("PUT")
+	router.HandleFunc("/campaigns/{campaignId}/ads/{tweetId}/", campaignsController.RemoveCampaignAd).Methods("DELETE")
+	router.HandleFunc("/campaigns/{campaignId}/reports/{year}/{month}/", campaignsController.GetCampaignMonthlyReport).Methods("GET")
+	router.HandleFunc("/campaigns/{campaignId}/reports/{year}/{month}/{day}/", campaignsController.GetCampaignDailyReport).Methods("GET")
 	router.HandleFunc("/{tweetId}/info/", adsController.GetAdInfo).Methods("GET")
+	router.HandleFunc("/{tweetId}/info/", adsController.DeleteAd).Methods("DELETE")
+	router.HandleFunc("/{tweetId}/timezone/", adsController.SetAdTimezone).Methods("PUT")
+	router.HandleFunc("/{tweetId}/schedule/", adsController.SetAdSchedule).Methods("PUT")
+	router.HandleFunc("/{tweetId}/schedule/history/", adsController.GetAdScheduleHistory).Methods("GET")
+	router.HandleFunc("/{tweetId}/status/", adsController.SetAdStatus).Methods("PUT")
+	router.HandleFunc("/{tweetId}/status/history/", adsController.GetAdStatusHistory).Methods("GET")
+	router.HandleFunc("/{tweetId}/targeting/", adsController.SetAdTargeting).Methods("PUT")
+	router.HandleFunc("/{tweetId}/targeting/history/", adsController.GetAdTargetingHistory).Methods("GET")
 	router.HandleFunc("/{tweetId}/visit/", adsController.AddProfileVisitedEvent).Methods("POST")
 	router.HandleFunc("/{tweetId}/view/", adsController.AddTweetViewedEvent).Methods("POST")
+	router.HandleFunc("/{tweetId}/click/", adsController.AddTweetClickedEvent).Methods("POST")
+	router.HandleFunc("/{tweetId}/audience/", adsController.GetAudienceBreakdown).Methods("GET")
+	router.HandleFunc("/{tweetId}/summary/", adsController.GetAdSummary).Methods("GET")
+	router.HandleFunc("/{tweetId}/reports/", adsController.GetRangeReport).Methods("GET")
+	router.HandleFunc("/{tweetId}/reports/series/", adsController.GetReportSeries).Methods("GET")
 	router.HandleFunc("/{tweetId}/reports/{year}/{month}/", adsController.GetMonthlyReport).Methods("GET")
 	router.HandleFunc("/{tweetId}/reports/{year}/{month}/{day}/", adsController.GetDailyReport).Methods("GET")
+	router.HandleFunc("/{tweetId}/reports/{year}/{month}/{day}/{hour}/", adsController.GetHourlyReport).Methods("GET")
+
+	// operational endpoints don't require a user token, so they're served on a port that's only reachable inside the
+	// cluster, without CORS
+	internalRouter := mux.NewRouter()
+	internalRouter.StrictSlash(true)
+	internalRouter.HandleFunc("/internal/aggregator/", aggregatorController.GetStats).Methods("GET")
+	internalRouter.HandleFunc("/internal/reconciler/", reconcilerController.GetStats).Methods("GET")
 
-	allowedHeaders := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
-	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "HEAD", "OPTIONS"})
+	allowedHeaders := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "Idempotency-Key"})
+	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS"})
 	allowedOrigins := handlers.AllowedOrigins([]string{"*"})
+	exposedHeaders := handlers.ExposedHeaders([]string{"Content-Disposition"})
 
 	// start server
 	srv := &http.Server{
 		Addr:      "0.0.0.0:8000",
-		Handler:   handlers.CORS(allowedHeaders, allowedMethods, allowedOrigins)(router),
+		Handler:   handlers.CORS(allowedHeaders, allowedMethods, allowedOrigins, exposedHeaders)(router),
+		TLSConfig: tls.GetHTTPServerTLSConfig(),
+	}
+
+	internalAddr := os.Getenv("INTERNAL_ADDR")
+	if internalAddr == "" {
+		internalAddr = "0.0.0.0:8001"
+	}
+
+	internalSrv := &http.Server{
+		Addr:      internalAddr,
+		Handler:   internalRouter,
 		TLSConfig: tls.GetHTTPServerTLSConfig(),
 	}
 
@@ -96,6 +197,16 @@ func main() {
 		}
 	}()
 
+	go func() {
+		log.Println("internal server starting")
+
+		if err := internalSrv.ListenAndServeTLS(os.Getenv("CERT"), os.Getenv("KEY")); err != nil {
+			if err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}
+	}()
+
 	lis, err := net.Listen("tcp", "0.0.0.0:9001")
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
@@ -106,25 +217,47 @@ func main() {
 	grpcServer := grpc.NewServer(
 		grpc.Creds(creds),
 		grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor()),
 	)
 
-	ads.RegisterAdsServiceServer(grpcServer, service.NewgRPCAdsService(tracer, eventsRepository, reportsRepository))
+	grpcAdsService := service.NewgRPCAdsService(tracer, eventsRepository, reportsRepository, aggregator)
+	ads.RegisterAdsServiceServer(grpcServer, grpcAdsService)
+	service.RegisterAdsBatchServiceServer(grpcServer, grpcAdsService)
+	service.RegisterAdsClickServiceServer(grpcServer, grpcAdsService)
+	service.RegisterAdsConversionServiceServer(grpcServer, grpcAdsService)
+	service.RegisterAdsListServiceServer(grpcServer, grpcAdsService)
+	service.RegisterAdScheduleServiceServer(grpcServer, grpcAdsService)
+	service.RegisterAdsReportServiceServer(grpcServer, grpcAdsService)
 	reflection.Register(grpcServer)
-	err = grpcServer.Serve(lis)
-	if err != nil {
-		return
-	}
+
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatal(err)
+		}
+	}()
 
 	<-quit
 
 	log.Println("service shutting down ...")
 
-	// gracefully stop server
+	// stop taking events before the aggregator flushes what it has queued
+	grpcServer.GracefulStop()
+	log.Println("grpc server stopped")
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// the aggregator is stopped even when requests didn't finish in time, so queued events are still flushed
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal(err)
+		log.Printf("server shutdown: %v", err)
 	}
 	log.Println("server stopped")
+
+	if err := internalSrv.Shutdown(ctx); err != nil {
+		log.Printf("internal server shutdown: %v", err)
+	}
+	log.Println("internal server stopped")
+
+	aggregator.Stop()
+	log.Println("report aggregator stopped")
 }
@@ -1,15 +1,24 @@
 package model
 
 import (
+	"github.com/FTN-TwitterClone/ads/histogram"
 	"github.com/gocql/gocql"
 	"time"
 )
 
 // Info from JWT token
 type AuthUser struct {
-	Username string
-	Role     string
-	Exp      time.Time
+	Username     string
+	Role         string
+	Exp          time.Time
+	Demographics Demographics
+}
+
+// Optional profile info of a viewer, empty when unknown
+type Demographics struct {
+	Age    int32
+	Gender string
+	Town   string
 }
 
 type AdInfo struct {
@@ -19,18 +28,257 @@ type AdInfo struct {
 	MinAge   int32      `json:"minAge"`
 	MaxAge   int32      `json:"maxAge"`
 	Gender   string     `json:"gender"`
+	Timezone string     `json:"timezone"`
+	Status   string     `json:"status"`
+	// CampaignId is empty for ads that aren't part of a campaign
+	CampaignId string `json:"campaignId,omitempty"`
+	// StatusChangedAt is zero for ads that have been active since before statuses were kept
+	StatusChangedAt time.Time `json:"statusChangedAt"`
+	// an empty schedule runs the ad whenever it's active
+	Schedule AdSchedule `json:"schedule"`
+}
+
+// AdSchedule limits when an ad runs in its timezone. Dates are inclusive and either can be empty, an ad without day
+// parts runs all day.
+type AdSchedule struct {
+	StartDate string    `json:"startDate,omitempty"`
+	EndDate   string    `json:"endDate,omitempty"`
+	DayParts  []DayPart `json:"dayParts,omitempty"`
+}
+
+// AdScheduleVersion is the schedule an ad had from ValidFrom until its next version
+type AdScheduleVersion struct {
+	AdSchedule `bson:",inline"`
+	ValidFrom  time.Time `json:"validFrom" bson:"validFrom"`
+	ChangedBy  string    `json:"changedBy" bson:"changedBy"`
+}
+
+// DayPart runs an ad from FromHour up to ToHour on the listed days, every day when there are none
+type DayPart struct {
+	Days     []string `json:"days,omitempty"`
+	FromHour int      `json:"fromHour"`
+	ToHour   int      `json:"toHour"`
+}
+
+// Lifecycle of an ad, only events of active ads are counted in reports
+const (
+	AD_DRAFT  = "draft"
+	AD_ACTIVE = "active"
+	AD_PAUSED = "paused"
+	AD_ENDED  = "ended"
+)
+
+type AdStatus struct {
+	Status string `json:"status"`
+}
+
+type AdStatusChange struct {
+	Status    string    `json:"status" bson:"status"`
+	ChangedAt time.Time `json:"changedAt" bson:"changedAt"`
+	ChangedBy string    `json:"changedBy" bson:"changedBy"`
+}
+
+// What a campaign is optimized for
+const (
+	AWARENESS_OBJECTIVE  = "awareness"
+	ENGAGEMENT_OBJECTIVE = "engagement"
+	TRAFFIC_OBJECTIVE    = "traffic"
+	FOLLOWERS_OBJECTIVE  = "followers"
+)
+
+// Group of promoted tweets of one advertiser, dates are formatted as 2006-01-02 and EndDate is empty while open-ended
+type Campaign struct {
+	Id        gocql.UUID `json:"id"`
+	Owner     string     `json:"owner"`
+	Name      string     `json:"name"`
+	Objective string     `json:"objective"`
+	StartDate string     `json:"startDate"`
+	EndDate   string     `json:"endDate,omitempty"`
+	TweetIds  []string   `json:"tweetIds"`
+}
+
+// Reports of every tweet of a campaign for one period and their sum, Day is 0 for monthly reports
+type CampaignReport struct {
+	CampaignId string   `json:"campaignId"`
+	Year       int64    `json:"year"`
+	Month      int64    `json:"month"`
+	Day        int64    `json:"day,omitempty"`
+	Total      Report   `json:"total"`
+	Tweets     []Report `json:"tweets"`
+}
+
+// Ad of an advertiser with its reports summed over its whole life
+type AdOverview struct {
+	AdInfo    AdInfo    `json:"adInfo"`
+	CreatedAt time.Time `json:"createdAt"`
+	Lifetime  Report    `json:"lifetime"`
 }
 
+// Page of the ads of an advertiser, Next is the cursor of the following page and empty on the last one
+type AdPage struct {
+	Ads  []AdOverview `json:"ads"`
+	Next string       `json:"next,omitempty"`
+}
+
+type AdTimezone struct {
+	Timezone string `json:"timezone"`
+}
+
+// Who an ad is shown to, empty or zero criteria match every viewer
+type AdTargeting struct {
+	Town   string `json:"town" bson:"town"`
+	MinAge int32  `json:"minAge" bson:"minAge"`
+	MaxAge int32  `json:"maxAge" bson:"maxAge"`
+	Gender string `json:"gender" bson:"gender"`
+}
+
+const (
+	MALE_GENDER   = "male"
+	FEMALE_GENDER = "female"
+)
+
+// AdTargetingVersion is the targeting an ad had from ValidFrom until its next version
+type AdTargetingVersion struct {
+	AdTargeting `bson:",inline"`
+	ValidFrom   time.Time `json:"validFrom" bson:"validFrom"`
+	ChangedBy   string    `json:"changedBy" bson:"changedBy"`
+}
+
+// ArchivedAd is what's kept of a deleted ad next to its archived reports
+type ArchivedAd struct {
+	TweetId          string               `json:"tweetId" bson:"tweetId"`
+	AdInfo           AdInfo               `json:"adInfo" bson:"adInfo"`
+	StatusHistory    []AdStatusChange     `json:"statusHistory" bson:"statusHistory"`
+	TargetingHistory []AdTargetingVersion `json:"targetingHistory" bson:"targetingHistory"`
+	ScheduleHistory  []AdScheduleVersion  `json:"scheduleHistory" bson:"scheduleHistory"`
+	ArchivedAt       time.Time            `json:"archivedAt" bson:"archivedAt"`
+	ArchivedBy       string               `json:"archivedBy" bson:"archivedBy"`
+}
+
+const (
+	LIKE_EVENT       = "like"
+	UNLIKE_EVENT     = "unlike"
+	VIEW_EVENT       = "view"
+	VISIT_EVENT      = "visit"
+	CLICK_EVENT      = "click"
+	CONVERSION_EVENT = "conversion"
+)
+
+// What was clicked in a tweet
+const (
+	LINK_CLICK    = "link"
+	MEDIA_CLICK   = "media"
+	HASHTAG_CLICK = "hashtag"
+)
+
+// Kinds of contact with an ad a conversion can be attributed to
+const (
+	VIEW_TOUCHPOINT       = "view"
+	ENGAGEMENT_TOUCHPOINT = "engagement"
+)
+
+// What a viewer did after seeing an ad
+const (
+	RETWEET_CONVERSION = "retweet"
+	REPLY_CONVERSION   = "reply"
+	FOLLOW_CONVERSION  = "follow"
+)
+
+// Event waiting to be counted in reports, Time is in the zone the ad's reports are bucketed in
+type ReportEvent struct {
+	Kind     string
+	TweetId  string
+	Username string
+	Time     time.Time
+	ViewTime int64
+	// ClickType is set on CLICK_EVENT
+	ClickType string
+	// ConversionType is set on CONVERSION_EVENT
+	ConversionType string
+	// Attributed conversions followed a view of or engagement with the ad within the attribution windows
+	Attributed bool
+	Segment    AudienceSegment
+	// Late events arrived past the lateness cutoff, Time is when they arrived and only LateEvents counts them
+	Late       bool
+	EnqueuedAt time.Time
+	// Inactive events happened while the ad wasn't active, only InactiveEvents counts them
+	Inactive bool
+}
+
+type AggregatorStats struct {
+	Queued        int   `json:"queued"`
+	QueueCapacity int   `json:"queueCapacity"`
+	Processed     int64 `json:"processed"`
+	Failed        int64 `json:"failed"`
+	DeadLettered  int64 `json:"deadLettered"`
+	LagMillis     int64 `json:"lagMillis"`
+	MaxLagMillis  int64 `json:"maxLagMillis"`
+}
+
+// DeadLetter is a month of an ad's reports missing events the aggregator couldn't write, it's recounted from the event
+// store in the background or by rebuild-reports --dead-letters
+type DeadLetter struct {
+	TweetId  string    `json:"tweetId" bson:"tweetId"`
+	Year     int64     `json:"year" bson:"year"`
+	Month    int64     `json:"month" bson:"month"`
+	Events   int       `json:"events" bson:"events"`
+	FailedAt time.Time `json:"failedAt" bson:"failedAt"`
+	Error    string    `json:"error" bson:"error"`
+}
+
+// One event of a batch sent by the web client, Type is VIEW_EVENT or VISIT_EVENT
+type BatchEvent struct {
+	Type       string    `json:"type"`
+	TweetId    string    `json:"tweetId"`
+	ViewTime   int32     `json:"viewTime"`
+	EventKey   string    `json:"eventKey"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+type BatchEventResult struct {
+	Index     int    `json:"index"`
+	Status    int    `json:"status"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Difference between a counter of a daily report and the events stored for that day
+type ReportDrift struct {
+	TweetId  string `json:"tweetId"`
+	Year     int64  `json:"year"`
+	Month    int64  `json:"month"`
+	Day      int64  `json:"day"`
+	Counter  string `json:"counter"`
+	Reported int64  `json:"reported"`
+	Counted  int64  `json:"counted"`
+}
+
+type ReconciliationStats struct {
+	Runs                int64         `json:"runs"`
+	DriftedReportsTotal int64         `json:"driftedReportsTotal"`
+	LastRunAt           time.Time     `json:"lastRunAt"`
+	AdsChecked          int           `json:"adsChecked"`
+	FailedAds           int           `json:"failedAds"`
+	ReportsChecked      int           `json:"reportsChecked"`
+	DriftedReports      int           `json:"driftedReports"`
+	RepairedReports     int           `json:"repairedReports"`
+	TotalDrift          int64         `json:"totalDrift"`
+	Drifts              []ReportDrift `json:"drifts"`
+}
+
+// Raw events are stored at Time, when they happened, except Late ones that are stored at when they arrived
 type TweetLikedEvent struct {
 	Username string
 	TweetId  gocql.UUID
 	Time     time.Time
+	Late     bool
 }
 
 type TweetUnlikedEvent struct {
 	Username string
 	TweetId  gocql.UUID
 	Time     time.Time
+	Late     bool
 }
 
 type TweetViewedEvent struct {
@@ -38,25 +286,194 @@ type TweetViewedEvent struct {
 	TweetId  gocql.UUID
 	ViewTime int32
 	Time     time.Time
+	Late     bool
+}
+
+type TweetClickedEvent struct {
+	Username  string
+	TweetId   gocql.UUID
+	ClickType string
+	Time      time.Time
+	Late      bool
+}
+
+type TweetConversionEvent struct {
+	Username       string
+	TweetId        gocql.UUID
+	ConversionType string
+	Time           time.Time
+	Late           bool
 }
 
 type ProfileVisitedEvent struct {
 	Username string
 	TweetId  gocql.UUID
 	Time     time.Time
+	Late     bool
 }
 
 type TweetViewTime struct {
-	ViewTime int32 `json:"viewTime"`
+	ViewTime   int32     `json:"viewTime"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+type TweetClick struct {
+	ClickType  string    `json:"clickType"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+type EventTime struct {
+	OccurredAt time.Time `json:"occurredAt"`
 }
 
 type Report struct {
-	TweetId         string `json:"tweetId" bson:"tweetId"`
-	Year            int64  `json:"year" bson:"year"`
-	Month           int64  `json:"month" bson:"month"`
-	Day             int64  `json:"day" bson:"day"`
-	LikesCount      int    `json:"likesCount" bson:"likesCount"`
-	UnlikesCount    int    `json:"unlikesCount" bson:"unlikesCount"`
-	ProfileVisits   int    `json:"profileVisits" bson:"profileVisits"`
-	AverageViewTime int    `json:"averageViewTime" bson:"averageViewTime"`
+	TweetId       string `json:"tweetId" bson:"tweetId"`
+	Year          int64  `json:"year" bson:"year"`
+	Month         int64  `json:"month" bson:"month"`
+	Day           int64  `json:"day" bson:"day"`
+	Hour          int64  `json:"hour" bson:"hour"`
+	From          string `json:"from,omitempty" bson:"-"`
+	To            string `json:"to,omitempty" bson:"-"`
+	LikesCount    int    `json:"likesCount" bson:"likesCount"`
+	UnlikesCount  int    `json:"unlikesCount" bson:"unlikesCount"`
+	ProfileVisits int    `json:"profileVisits" bson:"profileVisits"`
+	Impressions   int    `json:"impressions" bson:"impressions"`
+	LateEvents    int    `json:"lateEvents" bson:"lateEvents"`
+	Clicks        int    `json:"clicks" bson:"clicks"`
+	LinkClicks    int    `json:"linkClicks" bson:"linkClicks"`
+	MediaClicks   int    `json:"mediaClicks" bson:"mediaClicks"`
+	HashtagClicks int    `json:"hashtagClicks" bson:"hashtagClicks"`
+	Conversions   int    `json:"conversions" bson:"conversions"`
+	Retweets      int    `json:"retweets" bson:"retweets"`
+	Replies       int    `json:"replies" bson:"replies"`
+	Follows       int    `json:"follows" bson:"follows"`
+	// events of the ad while it was paused, ended or a draft
+	InactiveEvents int `json:"inactiveEvents" bson:"inactiveEvents"`
+	// visits, likes and conversions split by whether they followed contact with the ad
+	AttributedConversions int   `json:"attributedConversions" bson:"attributedConversions"`
+	OrganicConversions    int   `json:"organicConversions" bson:"organicConversions"`
+	ViewTimeSum           int64 `json:"-" bson:"viewTimeSum"`
+	ViewCount             int   `json:"-" bson:"viewCount"`
+	AverageViewTime       int   `json:"averageViewTime" bson:"averageViewTime"`
+	// estimated from the HyperLogLog sketches stored with the report
+	UniqueViewers         int `json:"uniqueViewers" bson:"-"`
+	UniqueProfileVisitors int `json:"uniqueProfileVisitors" bson:"-"`
+	UniqueLikers          int `json:"uniqueLikers" bson:"-"`
+	// estimated from the view time histogram stored with the report
+	ViewTimeMedian    int64              `json:"viewTimeMedian" bson:"-"`
+	ViewTimeP90       int64              `json:"viewTimeP90" bson:"-"`
+	ViewTimeP99       int64              `json:"viewTimeP99" bson:"-"`
+	ViewTimeHistogram []histogram.Bucket `json:"viewTimeHistogram" bson:"-"`
+	// derived from the counters by ComputeDerivedMetrics
+	NetLikes         int     `json:"netLikes" bson:"-"`
+	EngagementRate   float64 `json:"engagementRate" bson:"-"`
+	ProfileVisitRate float64 `json:"profileVisitRate" bson:"-"`
+	ClickThroughRate float64 `json:"clickThroughRate" bson:"-"`
+	ConversionRate   float64 `json:"conversionRate" bson:"-"`
+	// days of the period the ad was active on, set on reports of periods rather than stored
+	ActiveDays int `json:"activeDays,omitempty" bson:"-"`
+	// hours of the period the ad was active and on schedule, and hours it was seen in, set like ActiveDays. Hours it
+	// was seen in are null when not known, hourly reports past their retention are gone.
+	ScheduledHours int  `json:"scheduledHours,omitempty" bson:"-"`
+	DeliveredHours *int `json:"deliveredHours" bson:"-"`
+}
+
+// ComputeDerivedMetrics fills in the metrics calculated from the counters, rates are 0 while there are no impressions.
+// Reports that predate the view time totals keep their stored average until they are backfilled.
+func (r *Report) ComputeDerivedMetrics() {
+	if r.ViewCount > 0 {
+		r.AverageViewTime = int(r.ViewTimeSum / int64(r.ViewCount))
+	}
+
+	r.NetLikes = r.LikesCount - r.UnlikesCount
+	r.EngagementRate = 0
+	r.ProfileVisitRate = 0
+	r.ClickThroughRate = 0
+	r.ConversionRate = 0
+
+	if r.Impressions > 0 {
+		r.EngagementRate = float64(r.LikesCount+r.ProfileVisits) / float64(r.Impressions)
+		r.ProfileVisitRate = float64(r.ProfileVisits) / float64(r.Impressions)
+		r.ClickThroughRate = float64(r.Clicks) / float64(r.Impressions)
+		r.ConversionRate = float64(r.Conversions) / float64(r.Impressions)
+	}
+}
+
+// Periods reports are stored for
+const (
+	MONTHLY = "monthly"
+	DAILY   = "daily"
+	HOURLY  = "hourly"
+)
+
+// Identifies a stored report, fields finer than the period are 0
+type ReportKey struct {
+	TweetId string
+	Type    string
+	Year    int64
+	Month   int64
+	Day     int64
+	Hour    int64
+}
+
+const (
+	HOUR  = "hour"
+	DAY   = "day"
+	WEEK  = "week"
+	MONTH = "month"
+)
+
+type ReportSeries struct {
+	TweetId     string   `json:"tweetId"`
+	Granularity string   `json:"granularity"`
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Points      []Report `json:"points"`
+}
+
+type AdSummary struct {
+	AdInfo  AdInfo   `json:"adInfo"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Total   Report   `json:"total"`
+	Monthly []Report `json:"monthly"`
+	Daily   []Report `json:"daily"`
+	// every status change of the ad, not only the ones in the period
+	StatusHistory []AdStatusChange `json:"statusHistory"`
+	// every targeting the ad had, the audience of a period is on target for the versions valid in it
+	TargetingHistory []AdTargetingVersion `json:"targetingHistory"`
+	// every schedule the ad had, the scheduled hours of a period follow the versions valid in it
+	ScheduleHistory []AdScheduleVersion `json:"scheduleHistory"`
+}
+
+const (
+	LIKES  = "likes"
+	VIEWS  = "views"
+	VISITS = "visits"
+)
+
+// Group of viewers an engagement is counted under in audience breakdowns
+type AudienceSegment struct {
+	AgeBracket string
+	Gender     string
+	Town       string
+	OnTarget   bool
+}
+
+type EngagementCounts struct {
+	Likes  int `json:"likes" bson:"likes"`
+	Views  int `json:"views" bson:"views"`
+	Visits int `json:"visits" bson:"visits"`
+}
+
+type AudienceBreakdown struct {
+	TweetId         string                      `json:"tweetId" bson:"-"`
+	From            string                      `json:"from" bson:"-"`
+	To              string                      `json:"to" bson:"-"`
+	AgeBracket      map[string]EngagementCounts `json:"ageBracket" bson:"ageBracket"`
+	Gender          map[string]EngagementCounts `json:"gender" bson:"gender"`
+	Town            map[string]EngagementCounts `json:"town" bson:"town"`
+	OnTarget        EngagementCounts            `json:"onTarget" bson:"onTarget"`
+	Total           EngagementCounts            `json:"total" bson:"total"`
+	OnTargetPercent float64                     `json:"onTargetPercent" bson:"-"`
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/FTN-TwitterClone/ads/service"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"time"
+)
+
+// rebuildReports runs `main rebuild-reports --tweet <id> --from 2006-01-02 --to 2006-01-02 [--dry-run]`.
+func rebuildReports(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, args []string) error {
+	flags := flag.NewFlagSet("rebuild-reports", flag.ExitOnError)
+	tweetId := flags.String("tweet", "", "id of the ad tweet to rebuild, every ad when omitted")
+	fromFlag := flags.String("from", "", "first day to rebuild, its whole month is rebuilt")
+	toFlag := flags.String("to", time.Now().Format("2006-01-02"), "last day to rebuild, its whole month is rebuilt")
+	dryRun := flags.Bool("dry-run", false, "print the counters that would change without writing them")
+	deadLetters := flags.Bool("dead-letters", false, "rebuild the months the aggregator failed to write events to instead")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *deadLetters {
+		return service.RebuildDeadLetters(ctx, tracer, eventsRepository, reportsRepository, *dryRun, os.Stdout)
+	}
+
+	if *fromFlag == "" {
+		return errors.New("--from is required")
+	}
+
+	from, err := time.Parse("2006-01-02", *fromFlag)
+	if err != nil {
+		return err
+	}
+
+	to, err := time.Parse("2006-01-02", *toFlag)
+	if err != nil {
+		return err
+	}
+
+	if to.Before(from) {
+		return errors.New("--to is before --from")
+	}
+
+	return service.RebuildReports(ctx, tracer, eventsRepository, reportsRepository, service.RebuildOptions{
+		TweetId: *tweetId,
+		From:    from,
+		To:      to,
+		DryRun:  *dryRun,
+		Out:     os.Stdout,
+	})
+}
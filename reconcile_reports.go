@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/FTN-TwitterClone/ads/service"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// reconcileReports runs `main reconcile-reports [--tweet <id>] [--sample 20] [--days 7] [--repair]` once.
+func reconcileReports(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, args []string) error {
+	flags := flag.NewFlagSet("reconcile-reports", flag.ExitOnError)
+	tweetId := flags.String("tweet", "", "id of the ad tweet to check, a random sample of ads when omitted")
+	sample := flags.Int("sample", 20, "number of ads to check")
+	days := flags.Int("days", 7, "number of whole days to check, ending before the lateness cutoff")
+	repair := flags.Bool("repair", false, "correct the daily and monthly counters that drifted, hourly reports are left as they are")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	reconciler := service.NewReportReconciler(eventsRepository, reportsRepository, tracer, service.ReconcileOptions{
+		TweetId: *tweetId,
+		Sample:  *sample,
+		Days:    *days,
+		Repair:  *repair,
+	})
+
+	run, err := reconciler.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range run.Drifts {
+		fmt.Printf("%s %04d-%02d-%02d %s: reported %d, counted %d\n", d.TweetId, d.Year, d.Month, d.Day, d.Counter, d.Reported, d.Counted)
+	}
+
+	fmt.Printf("checked %d daily reports of %d ads, %d drifted by %d in total, %d repaired\n", run.ReportsChecked, run.AdsChecked, run.DriftedReports, run.TotalDrift, run.RepairedReports)
+
+	if run.FailedAds > 0 {
+		fmt.Printf("%d ads couldn't be checked\n", run.FailedAds)
+	}
+
+	return nil
+}
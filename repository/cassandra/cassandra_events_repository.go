@@ -2,6 +2,7 @@ package cassandra
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/FTN-TwitterClone/ads/model"
 	"github.com/gocql/gocql"
@@ -106,9 +107,13 @@ func (r *CassandraEventsRepository) SaveAdInfo(ctx context.Context, adInfo *mode
 	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveTweetLikedEvent")
 	defer span.End()
 
-	err := r.session.Query("INSERT INTO ad_info(tweet_id, posted_by, town, min_age, max_age, gender) VALUES (?, ?, ?, ?, ?, ?)").
-		Bind(adInfo.TweetId, adInfo.PostedBy, adInfo.Town, adInfo.MinAge, adInfo.MaxAge, adInfo.Gender).
-		Exec()
+	b := r.session.NewBatch(gocql.LoggedBatch)
+	// the timezone is only set through UpdateAdTimezone, an ad saved again keeps it
+	b.Query("INSERT INTO ad_info(tweet_id, posted_by, town, min_age, max_age, gender) VALUES (?, ?, ?, ?, ?, ?)",
+		adInfo.TweetId, adInfo.PostedBy, adInfo.Town, adInfo.MinAge, adInfo.MaxAge, adInfo.Gender)
+	b.Query("INSERT INTO ads_by_owner(posted_by, tweet_id) VALUES (?, ?)", adInfo.PostedBy, adInfo.TweetId)
+
+	err := r.session.ExecuteBatch(b)
 
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
@@ -123,25 +128,131 @@ func (r *CassandraEventsRepository) GetAdInfo(ctx context.Context, tweetId strin
 	defer span.End()
 
 	var adInfo model.AdInfo
+	var schedule string
 
-	err := r.session.Query("SELECT tweet_id, posted_by, town, min_age, max_age, gender FROM ad_info WHERE tweet_id = ?").
+	err := r.session.Query("SELECT tweet_id, posted_by, town, min_age, max_age, gender, timezone, campaign_id, status, status_changed_at, schedule FROM ad_info WHERE tweet_id = ?").
 		Bind(tweetId).
-		Scan(&adInfo.TweetId, &adInfo.PostedBy, &adInfo.Town, &adInfo.MinAge, &adInfo.MaxAge, &adInfo.Gender)
+		Scan(&adInfo.TweetId, &adInfo.PostedBy, &adInfo.Town, &adInfo.MinAge, &adInfo.MaxAge, &adInfo.Gender, &adInfo.Timezone, &adInfo.CampaignId, &adInfo.Status, &adInfo.StatusChangedAt, &schedule)
 
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
+	if schedule != "" {
+		err = json.Unmarshal([]byte(schedule), &adInfo.Schedule)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+	}
+
+	// ads saved before statuses were kept have been active all along
+	if adInfo.Status == "" {
+		adInfo.Status = model.AD_ACTIVE
+	}
+
 	return &adInfo, nil
 }
 
+func (r *CassandraEventsRepository) UpdateAdTimezone(ctx context.Context, tweetId string, timezone string) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.UpdateAdTimezone")
+	defer span.End()
+
+	err := r.session.Query("UPDATE ad_info SET timezone = ? WHERE tweet_id = ?").
+		Bind(timezone, tweetId).
+		Exec()
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// UpdateAdSchedule sets the schedule of an ad and adds it to its history, schedules are stored as JSON and an empty
+// one is removed.
+func (r *CassandraEventsRepository) UpdateAdSchedule(ctx context.Context, tweetId string, version *model.AdScheduleVersion) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.UpdateAdSchedule")
+	defer span.End()
+
+	schedule, err := encodeSchedule(&version.AdSchedule)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	b := r.session.NewBatch(gocql.LoggedBatch)
+	b.Query("UPDATE ad_info SET schedule = ? WHERE tweet_id = ?", schedule, tweetId)
+	b.Query("INSERT INTO ad_schedule_history(tweet_id, valid_from, schedule, changed_by) VALUES (?, ?, ?, ?)",
+		tweetId, version.ValidFrom.UTC(), schedule, version.ChangedBy)
+
+	err = r.session.ExecuteBatch(b)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetAdScheduleHistory lists the schedule versions of an ad, oldest first.
+func (r *CassandraEventsRepository) GetAdScheduleHistory(ctx context.Context, tweetId string) ([]model.AdScheduleVersion, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetAdScheduleHistory")
+	defer span.End()
+
+	history := []model.AdScheduleVersion{}
+	var validFrom time.Time
+	var schedule string
+	var changedBy string
+
+	iter := r.session.Query("SELECT valid_from, schedule, changed_by FROM ad_schedule_history WHERE tweet_id = ?").
+		Bind(tweetId).
+		PageSize(1000).
+		Iter()
+	for iter.Scan(&validFrom, &schedule, &changedBy) {
+		version := model.AdScheduleVersion{ValidFrom: validFrom, ChangedBy: changedBy}
+		if schedule != "" {
+			err := json.Unmarshal([]byte(schedule), &version.AdSchedule)
+			if err != nil {
+				_ = iter.Close()
+				span.SetStatus(codes.Error, err.Error())
+				return nil, err
+			}
+		}
+		history = append(history, version)
+	}
+
+	err := iter.Close()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// encodeSchedule returns the JSON a schedule is stored as, or nil for an empty one.
+func encodeSchedule(schedule *model.AdSchedule) (interface{}, error) {
+	if schedule.StartDate == "" && schedule.EndDate == "" && len(schedule.DayParts) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(encoded), nil
+}
+
 func (r *CassandraEventsRepository) SaveTweetLikedEvent(ctx context.Context, tweetLikedEvent *model.TweetLikedEvent) error {
 	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveTweetLikedEvent")
 	defer span.End()
 
-	err := r.session.Query("INSERT INTO tweet_liked_events(tweet_id, id, username) VALUES (?, ?, ?)").
-		Bind(tweetLikedEvent.TweetId, gocql.UUIDFromTime(tweetLikedEvent.Time.UTC()), tweetLikedEvent.Username).
+	err := r.session.Query("INSERT INTO tweet_liked_events(tweet_id, id, username, late) VALUES (?, ?, ?, ?)").
+		Bind(tweetLikedEvent.TweetId, gocql.UUIDFromTime(tweetLikedEvent.Time.UTC()), tweetLikedEvent.Username, tweetLikedEvent.Late).
 		Exec()
 
 	if err != nil {
@@ -156,8 +267,8 @@ func (r *CassandraEventsRepository) SaveTweetUnlikedEvent(ctx context.Context, t
 	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveTweetLikedEvent")
 	defer span.End()
 
-	err := r.session.Query("INSERT INTO tweet_unliked_events(tweet_id, id, username) VALUES (?, ?, ?)").
-		Bind(tweetUnlikedEvent.TweetId, gocql.UUIDFromTime(tweetUnlikedEvent.Time.UTC()), tweetUnlikedEvent.Username).
+	err := r.session.Query("INSERT INTO tweet_unliked_events(tweet_id, id, username, late) VALUES (?, ?, ?, ?)").
+		Bind(tweetUnlikedEvent.TweetId, gocql.UUIDFromTime(tweetUnlikedEvent.Time.UTC()), tweetUnlikedEvent.Username, tweetUnlikedEvent.Late).
 		Exec()
 
 	if err != nil {
@@ -172,8 +283,8 @@ func (r *CassandraEventsRepository) SaveTweetViewedEvent(ctx context.Context, tw
 	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveTweetLikedEvent")
 	defer span.End()
 
-	err := r.session.Query("INSERT INTO tweet_viewed_events(tweet_id, id, username, view_time) VALUES (?, ?, ?, ?)").
-		Bind(tweetViewedEvent.TweetId, gocql.UUIDFromTime(tweetViewedEvent.Time.UTC()), tweetViewedEvent.Username, tweetViewedEvent.ViewTime).
+	err := r.session.Query("INSERT INTO tweet_viewed_events(tweet_id, id, username, view_time, late) VALUES (?, ?, ?, ?, ?)").
+		Bind(tweetViewedEvent.TweetId, gocql.UUIDFromTime(tweetViewedEvent.Time.UTC()), tweetViewedEvent.Username, tweetViewedEvent.ViewTime, tweetViewedEvent.Late).
 		Exec()
 
 	if err != nil {
@@ -188,8 +299,40 @@ func (r *CassandraEventsRepository) SaveProfileVisitedEvent(ctx context.Context,
 	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveProfileVisitedEvent")
 	defer span.End()
 
-	err := r.session.Query("INSERT INTO profile_visited_events(tweet_id, id, username) VALUES (?, ?, ?)").
-		Bind(profileVisitedEvent.TweetId, gocql.UUIDFromTime(profileVisitedEvent.Time.UTC()), profileVisitedEvent.Username).
+	err := r.session.Query("INSERT INTO profile_visited_events(tweet_id, id, username, late) VALUES (?, ?, ?, ?)").
+		Bind(profileVisitedEvent.TweetId, gocql.UUIDFromTime(profileVisitedEvent.Time.UTC()), profileVisitedEvent.Username, profileVisitedEvent.Late).
+		Exec()
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *CassandraEventsRepository) SaveTweetClickedEvent(ctx context.Context, tweetClickedEvent *model.TweetClickedEvent) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveTweetClickedEvent")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO tweet_clicked_events(tweet_id, id, username, click_type, late) VALUES (?, ?, ?, ?, ?)").
+		Bind(tweetClickedEvent.TweetId, gocql.UUIDFromTime(tweetClickedEvent.Time.UTC()), tweetClickedEvent.Username, tweetClickedEvent.ClickType, tweetClickedEvent.Late).
+		Exec()
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *CassandraEventsRepository) SaveTweetConversionEvent(ctx context.Context, tweetConversionEvent *model.TweetConversionEvent) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveTweetConversionEvent")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO tweet_conversion_events(tweet_id, id, username, conversion_type, late) VALUES (?, ?, ?, ?, ?)").
+		Bind(tweetConversionEvent.TweetId, gocql.UUIDFromTime(tweetConversionEvent.Time.UTC()), tweetConversionEvent.Username, tweetConversionEvent.ConversionType, tweetConversionEvent.Late).
 		Exec()
 
 	if err != nil {
@@ -200,6 +343,45 @@ func (r *CassandraEventsRepository) SaveProfileVisitedEvent(ctx context.Context,
 	return nil
 }
 
+func (r *CassandraEventsRepository) SaveViewerDemographics(ctx context.Context, username string, demographics *model.Demographics) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveViewerDemographics")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO viewer_demographics(username, age, gender, town) VALUES (?, ?, ?, ?)").
+		Bind(username, demographics.Age, demographics.Gender, demographics.Town).
+		Exec()
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetViewerDemographics returns the last known demographics of a viewer, empty ones if they were never seen.
+func (r *CassandraEventsRepository) GetViewerDemographics(ctx context.Context, username string) (*model.Demographics, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetViewerDemographics")
+	defer span.End()
+
+	var demographics model.Demographics
+
+	err := r.session.Query("SELECT age, gender, town FROM viewer_demographics WHERE username = ?").
+		Bind(username).
+		Scan(&demographics.Age, &demographics.Gender, &demographics.Town)
+
+	if err == gocql.ErrNotFound {
+		return &demographics, nil
+	}
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &demographics, nil
+}
+
 func (r *CassandraEventsRepository) GetAverageTweetViewTime(ctx context.Context, tweetId gocql.UUID, from time.Time, to time.Time) (int, error) {
 	_, span := r.tracer.Start(ctx, "CassandraAdsRepository.GetAverageTweetViewTime")
 	defer span.End()
@@ -217,3 +399,572 @@ func (r *CassandraEventsRepository) GetAverageTweetViewTime(ctx context.Context,
 
 	return viewTime, err
 }
+
+func (r *CassandraEventsRepository) GetTweetViewTimeTotals(ctx context.Context, tweetId gocql.UUID, from time.Time, to time.Time) (int64, int, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetTweetViewTimeTotals")
+	defer span.End()
+
+	var viewTimeSum int64
+	var viewCount int
+
+	err := r.session.Query("SELECT SUM(CAST(view_time AS bigint)), COUNT(*) FROM tweet_viewed_events WHERE tweet_id = ? AND id > maxTimeuuid(?) AND id < minTimeuuid(?)").
+		Bind(tweetId, from.UTC(), to.UTC()).
+		Scan(&viewTimeSum, &viewCount)
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return 0, 0, err
+	}
+
+	return viewTimeSum, viewCount, nil
+}
+
+// GetAdTweetIds lists every ad, it scans the whole ad_info table and is meant for maintenance jobs.
+func (r *CassandraEventsRepository) GetAdTweetIds(ctx context.Context) ([]string, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetAdTweetIds")
+	defer span.End()
+
+	var tweetIds []string
+	var tweetId gocql.UUID
+
+	iter := r.session.Query("SELECT tweet_id FROM ad_info").PageSize(1000).Iter()
+	for iter.Scan(&tweetId) {
+		tweetIds = append(tweetIds, tweetId.String())
+	}
+
+	err := iter.Close()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return tweetIds, nil
+}
+
+// GetAdsByOwner reads a page of the ads of owner, newest first. pageState is nil for the first page, the returned one is
+// nil after the last page.
+func (r *CassandraEventsRepository) GetAdsByOwner(ctx context.Context, owner string, pageSize int, pageState []byte) ([]string, []byte, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetAdsByOwner")
+	defer span.End()
+
+	tweetIds := []string{}
+	var tweetId gocql.UUID
+
+	iter := r.session.Query("SELECT tweet_id FROM ads_by_owner WHERE posted_by = ?").
+		Bind(owner).
+		PageSize(pageSize).
+		PageState(pageState).
+		Iter()
+
+	// only the rows of this page are scanned, scanning past them would fetch the next one
+	nextPageState := iter.PageState()
+	rows := iter.NumRows()
+	for i := 0; i < rows && iter.Scan(&tweetId); i++ {
+		tweetIds = append(tweetIds, tweetId.String())
+	}
+
+	err := iter.Close()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, nil, err
+	}
+
+	if len(nextPageState) == 0 {
+		nextPageState = nil
+	}
+
+	return tweetIds, nextPageState, nil
+}
+
+// BackfillAdsByOwner indexes the ads saved before ads_by_owner existed by their poster and returns how many ads it saw.
+func (r *CassandraEventsRepository) BackfillAdsByOwner(ctx context.Context) (int, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.BackfillAdsByOwner")
+	defer span.End()
+
+	count := 0
+	var tweetId gocql.UUID
+	var postedBy string
+
+	iter := r.session.Query("SELECT tweet_id, posted_by FROM ad_info").PageSize(1000).Iter()
+	for iter.Scan(&tweetId, &postedBy) {
+		err := r.session.Query("INSERT INTO ads_by_owner(posted_by, tweet_id) VALUES (?, ?)").
+			Bind(postedBy, tweetId).
+			Exec()
+		if err != nil {
+			iter.Close()
+			span.SetStatus(codes.Error, err.Error())
+			return count, err
+		}
+		count++
+	}
+
+	err := iter.Close()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return count, err
+	}
+
+	return count, nil
+}
+
+// GetTweetEvents reads every event of a tweet that happened in [from, to), ordered by table and then time. Late events
+// are read at when they arrived, the way they were counted.
+func (r *CassandraEventsRepository) GetTweetEvents(ctx context.Context, tweetId gocql.UUID, from time.Time, to time.Time) ([]model.ReportEvent, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetTweetEvents")
+	defer span.End()
+
+	tables := []struct {
+		kind  string
+		table string
+	}{
+		{model.LIKE_EVENT, "tweet_liked_events"},
+		{model.UNLIKE_EVENT, "tweet_unliked_events"},
+		{model.VIEW_EVENT, "tweet_viewed_events"},
+		{model.VISIT_EVENT, "profile_visited_events"},
+		{model.CLICK_EVENT, "tweet_clicked_events"},
+		{model.CONVERSION_EVENT, "tweet_conversion_events"},
+	}
+
+	var events []model.ReportEvent
+
+	for _, t := range tables {
+		columns := "id, username, late"
+		switch t.kind {
+		case model.VIEW_EVENT:
+			columns += ", view_time"
+		case model.CLICK_EVENT:
+			columns += ", click_type"
+		case model.CONVERSION_EVENT:
+			columns += ", conversion_type"
+		}
+
+		iter := r.session.Query(fmt.Sprintf("SELECT %s FROM %s WHERE tweet_id = ? AND id >= minTimeuuid(?) AND id < minTimeuuid(?)", columns, t.table)).
+			Bind(tweetId, from.UTC(), to.UTC()).
+			PageSize(1000).
+			Iter()
+
+		var id gocql.UUID
+		var username string
+		var late bool
+		var viewTime int
+		var clickType string
+		var conversionType string
+
+		dest := []interface{}{&id, &username, &late}
+		switch t.kind {
+		case model.VIEW_EVENT:
+			dest = append(dest, &viewTime)
+		case model.CLICK_EVENT:
+			dest = append(dest, &clickType)
+		case model.CONVERSION_EVENT:
+			dest = append(dest, &conversionType)
+		}
+
+		for iter.Scan(dest...) {
+			events = append(events, model.ReportEvent{
+				Kind:           t.kind,
+				TweetId:        tweetId.String(),
+				Username:       username,
+				Time:           id.Time(),
+				ViewTime:       int64(viewTime),
+				ClickType:      clickType,
+				ConversionType: conversionType,
+				Late:           late,
+			})
+		}
+
+		err := iter.Close()
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+// ClaimEventKey remembers an event key for window and reports whether it wasn't already remembered.
+func (r *CassandraEventsRepository) ClaimEventKey(ctx context.Context, tweetId gocql.UUID, kind string, username string, eventKey string, window time.Duration) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.ClaimEventKey")
+	defer span.End()
+
+	applied, err := r.session.Query("INSERT INTO event_keys(tweet_id, kind, username, event_key) VALUES (?, ?, ?, ?) IF NOT EXISTS USING TTL ?").
+		Bind(tweetId, kind, username, eventKey, int(window.Seconds())).
+		MapScanCAS(map[string]interface{}{})
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+
+	return applied, nil
+}
+
+// ReleaseEventKey forgets an event key so the event can be sent again after it failed.
+func (r *CassandraEventsRepository) ReleaseEventKey(ctx context.Context, tweetId gocql.UUID, kind string, username string, eventKey string) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.ReleaseEventKey")
+	defer span.End()
+
+	err := r.session.Query("DELETE FROM event_keys WHERE tweet_id = ? AND kind = ? AND username = ? AND event_key = ? IF EXISTS").
+		Bind(tweetId, kind, username, eventKey).
+		Exec()
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// SaveEvents stores events with one unlogged batch per table partition. The returned errors line up with events,
+// every event of a partition gets the error of its batch.
+func (r *CassandraEventsRepository) SaveEvents(ctx context.Context, events []model.ReportEvent) []error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveEvents")
+	defer span.End()
+
+	type partition struct {
+		kind    string
+		tweetId string
+	}
+
+	batches := map[partition]*gocql.Batch{}
+	indexes := map[partition][]int{}
+	errs := make([]error, len(events))
+
+	for i, e := range events {
+		tweetId, err := gocql.ParseUUID(e.TweetId)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		p := partition{e.Kind, e.TweetId}
+		batch, ok := batches[p]
+		if !ok {
+			batch = r.session.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+			batches[p] = batch
+		}
+		indexes[p] = append(indexes[p], i)
+
+		id := gocql.UUIDFromTime(e.Time.UTC())
+
+		switch e.Kind {
+		case model.LIKE_EVENT:
+			batch.Query("INSERT INTO tweet_liked_events(tweet_id, id, username, late) VALUES (?, ?, ?, ?)", tweetId, id, e.Username, e.Late)
+		case model.UNLIKE_EVENT:
+			batch.Query("INSERT INTO tweet_unliked_events(tweet_id, id, username, late) VALUES (?, ?, ?, ?)", tweetId, id, e.Username, e.Late)
+		case model.VIEW_EVENT:
+			batch.Query("INSERT INTO tweet_viewed_events(tweet_id, id, username, view_time, late) VALUES (?, ?, ?, ?, ?)", tweetId, id, e.Username, int(e.ViewTime), e.Late)
+		case model.VISIT_EVENT:
+			batch.Query("INSERT INTO profile_visited_events(tweet_id, id, username, late) VALUES (?, ?, ?, ?)", tweetId, id, e.Username, e.Late)
+		case model.CLICK_EVENT:
+			batch.Query("INSERT INTO tweet_clicked_events(tweet_id, id, username, click_type, late) VALUES (?, ?, ?, ?, ?)", tweetId, id, e.Username, e.ClickType, e.Late)
+		case model.CONVERSION_EVENT:
+			batch.Query("INSERT INTO tweet_conversion_events(tweet_id, id, username, conversion_type, late) VALUES (?, ?, ?, ?, ?)", tweetId, id, e.Username, e.ConversionType, e.Late)
+		}
+	}
+
+	for p, batch := range batches {
+		err := r.session.ExecuteBatch(batch)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			for _, i := range indexes[p] {
+				errs[i] = err
+			}
+		}
+	}
+
+	return errs
+}
+
+// SaveTouchpoint remembers that a user saw or engaged with an ad at a time, for ttl.
+func (r *CassandraEventsRepository) SaveTouchpoint(ctx context.Context, tweetId gocql.UUID, username string, kind string, at time.Time, ttl time.Duration) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveTouchpoint")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO viewer_touchpoints(tweet_id, username, kind, at) VALUES (?, ?, ?, ?) USING TTL ?").
+		Bind(tweetId, username, kind, at.UTC(), int(ttl.Seconds())).
+		Exec()
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// HasTouchpoint reports whether a user has a touchpoint of kind with an ad in [from, to].
+func (r *CassandraEventsRepository) HasTouchpoint(ctx context.Context, tweetId gocql.UUID, username string, kind string, from time.Time, to time.Time) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.HasTouchpoint")
+	defer span.End()
+
+	var at time.Time
+
+	err := r.session.Query("SELECT at FROM viewer_touchpoints WHERE tweet_id = ? AND username = ? AND kind = ? AND at >= ? AND at <= ? LIMIT 1").
+		Bind(tweetId, username, kind, from.UTC(), to.UTC()).
+		Scan(&at)
+
+	if err == gocql.ErrNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UpdateAdStatus sets the status of an ad and adds the change to its history.
+func (r *CassandraEventsRepository) UpdateAdStatus(ctx context.Context, tweetId string, change *model.AdStatusChange) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.UpdateAdStatus")
+	defer span.End()
+
+	b := r.session.NewBatch(gocql.LoggedBatch)
+	b.Query("UPDATE ad_info SET status = ?, status_changed_at = ? WHERE tweet_id = ?", change.Status, change.ChangedAt.UTC(), tweetId)
+	b.Query("INSERT INTO ad_status_history(tweet_id, changed_at, status, changed_by) VALUES (?, ?, ?, ?)", tweetId, change.ChangedAt.UTC(), change.Status, change.ChangedBy)
+
+	err := r.session.ExecuteBatch(b)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetAdStatusHistory lists the status changes of an ad, oldest first.
+func (r *CassandraEventsRepository) GetAdStatusHistory(ctx context.Context, tweetId string) ([]model.AdStatusChange, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetAdStatusHistory")
+	defer span.End()
+
+	history := []model.AdStatusChange{}
+	var change model.AdStatusChange
+
+	iter := r.session.Query("SELECT status, changed_at, changed_by FROM ad_status_history WHERE tweet_id = ?").
+		Bind(tweetId).
+		PageSize(1000).
+		Iter()
+	for iter.Scan(&change.Status, &change.ChangedAt, &change.ChangedBy) {
+		history = append(history, change)
+	}
+
+	err := iter.Close()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// UpdateAdTargeting sets the targeting of an ad and adds it to its targeting history.
+func (r *CassandraEventsRepository) UpdateAdTargeting(ctx context.Context, tweetId string, version *model.AdTargetingVersion) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.UpdateAdTargeting")
+	defer span.End()
+
+	b := r.session.NewBatch(gocql.LoggedBatch)
+	b.Query("UPDATE ad_info SET town = ?, min_age = ?, max_age = ?, gender = ? WHERE tweet_id = ?",
+		version.Town, version.MinAge, version.MaxAge, version.Gender, tweetId)
+	b.Query("INSERT INTO ad_targeting_history(tweet_id, valid_from, town, min_age, max_age, gender, changed_by) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		tweetId, version.ValidFrom.UTC(), version.Town, version.MinAge, version.MaxAge, version.Gender, version.ChangedBy)
+
+	err := r.session.ExecuteBatch(b)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetAdTargetingHistory lists the targeting versions of an ad, oldest first.
+func (r *CassandraEventsRepository) GetAdTargetingHistory(ctx context.Context, tweetId string) ([]model.AdTargetingVersion, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetAdTargetingHistory")
+	defer span.End()
+
+	history := []model.AdTargetingVersion{}
+	var version model.AdTargetingVersion
+
+	iter := r.session.Query("SELECT valid_from, town, min_age, max_age, gender, changed_by FROM ad_targeting_history WHERE tweet_id = ?").
+		Bind(tweetId).
+		PageSize(1000).
+		Iter()
+	for iter.Scan(&version.ValidFrom, &version.Town, &version.MinAge, &version.MaxAge, &version.Gender, &version.ChangedBy) {
+		history = append(history, version)
+	}
+
+	err := iter.Close()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// DeleteAdInfo deletes an ad together with its histories and takes it out of its advertiser's ads and its campaign.
+// Events of the tweet are kept.
+func (r *CassandraEventsRepository) DeleteAdInfo(ctx context.Context, adInfo *model.AdInfo) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.DeleteAdInfo")
+	defer span.End()
+
+	b := r.session.NewBatch(gocql.LoggedBatch)
+	b.Query("DELETE FROM ad_info WHERE tweet_id = ?", adInfo.TweetId)
+	b.Query("DELETE FROM ads_by_owner WHERE posted_by = ? AND tweet_id = ?", adInfo.PostedBy, adInfo.TweetId)
+	b.Query("DELETE FROM ad_status_history WHERE tweet_id = ?", adInfo.TweetId)
+	b.Query("DELETE FROM ad_targeting_history WHERE tweet_id = ?", adInfo.TweetId)
+	b.Query("DELETE FROM ad_schedule_history WHERE tweet_id = ?", adInfo.TweetId)
+	if adInfo.CampaignId != "" {
+		b.Query("DELETE FROM campaign_ads WHERE campaign_id = ? AND tweet_id = ?", adInfo.CampaignId, adInfo.TweetId)
+	}
+
+	err := r.session.ExecuteBatch(b)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *CassandraEventsRepository) SaveCampaign(ctx context.Context, campaign *model.Campaign) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SaveCampaign")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO campaigns(owner, id, name, objective, start_date, end_date) VALUES (?, ?, ?, ?, ?, ?)").
+		Bind(campaign.Owner, campaign.Id, campaign.Name, campaign.Objective, campaign.StartDate, campaign.EndDate).
+		Exec()
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// GetCampaign returns gocql.ErrNotFound when owner has no campaign with the id.
+func (r *CassandraEventsRepository) GetCampaign(ctx context.Context, owner string, campaignId string) (*model.Campaign, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetCampaign")
+	defer span.End()
+
+	var campaign model.Campaign
+
+	err := r.session.Query("SELECT owner, id, name, objective, start_date, end_date FROM campaigns WHERE owner = ? AND id = ?").
+		Bind(owner, campaignId).
+		Scan(&campaign.Owner, &campaign.Id, &campaign.Name, &campaign.Objective, &campaign.StartDate, &campaign.EndDate)
+
+	if err != nil {
+		if err != gocql.ErrNotFound {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return nil, err
+	}
+
+	return &campaign, nil
+}
+
+// GetCampaigns lists the campaigns of owner, newest first.
+func (r *CassandraEventsRepository) GetCampaigns(ctx context.Context, owner string) ([]model.Campaign, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetCampaigns")
+	defer span.End()
+
+	campaigns := []model.Campaign{}
+	var campaign model.Campaign
+
+	iter := r.session.Query("SELECT owner, id, name, objective, start_date, end_date FROM campaigns WHERE owner = ?").
+		Bind(owner).
+		PageSize(1000).
+		Iter()
+	for iter.Scan(&campaign.Owner, &campaign.Id, &campaign.Name, &campaign.Objective, &campaign.StartDate, &campaign.EndDate) {
+		campaigns = append(campaigns, campaign)
+	}
+
+	err := iter.Close()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return campaigns, nil
+}
+
+// DeleteCampaign deletes a campaign and detaches its tweets from it, their ads and reports are kept.
+func (r *CassandraEventsRepository) DeleteCampaign(ctx context.Context, owner string, campaignId string) error {
+	serviceCtx, span := r.tracer.Start(ctx, "CassandraEventsRepository.DeleteCampaign")
+	defer span.End()
+
+	tweetIds, err := r.GetCampaignTweetIds(serviceCtx, campaignId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	b := r.session.NewBatch(gocql.LoggedBatch)
+	for _, tweetId := range tweetIds {
+		b.Query("UPDATE ad_info SET campaign_id = null WHERE tweet_id = ?", tweetId)
+	}
+	b.Query("DELETE FROM campaign_ads WHERE campaign_id = ?", campaignId)
+	b.Query("DELETE FROM campaigns WHERE owner = ? AND id = ?", owner, campaignId)
+
+	err = r.session.ExecuteBatch(b)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// SetAdCampaign moves an ad from previousCampaignId to campaignId, either one is empty when the ad isn't in a campaign.
+func (r *CassandraEventsRepository) SetAdCampaign(ctx context.Context, tweetId string, previousCampaignId string, campaignId string) error {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.SetAdCampaign")
+	defer span.End()
+
+	b := r.session.NewBatch(gocql.LoggedBatch)
+	if previousCampaignId != "" {
+		b.Query("DELETE FROM campaign_ads WHERE campaign_id = ? AND tweet_id = ?", previousCampaignId, tweetId)
+	}
+	if campaignId != "" {
+		b.Query("INSERT INTO campaign_ads(campaign_id, tweet_id) VALUES (?, ?)", campaignId, tweetId)
+		b.Query("UPDATE ad_info SET campaign_id = ? WHERE tweet_id = ?", campaignId, tweetId)
+	} else {
+		b.Query("UPDATE ad_info SET campaign_id = null WHERE tweet_id = ?", tweetId)
+	}
+
+	err := r.session.ExecuteBatch(b)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (r *CassandraEventsRepository) GetCampaignTweetIds(ctx context.Context, campaignId string) ([]string, error) {
+	_, span := r.tracer.Start(ctx, "CassandraEventsRepository.GetCampaignTweetIds")
+	defer span.End()
+
+	tweetIds := []string{}
+	var tweetId gocql.UUID
+
+	iter := r.session.Query("SELECT tweet_id FROM campaign_ads WHERE campaign_id = ?").
+		Bind(campaignId).
+		PageSize(1000).
+		Iter()
+	for iter.Scan(&tweetId) {
+		tweetIds = append(tweetIds, tweetId.String())
+	}
+
+	err := iter.Close()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return tweetIds, nil
+}
@@ -10,9 +10,37 @@ import (
 type EventsRepository interface {
 	SaveAdInfo(ctx context.Context, adInfo *model.AdInfo) error
 	GetAdInfo(ctx context.Context, tweetId string) (*model.AdInfo, error)
+	UpdateAdTimezone(ctx context.Context, tweetId string, timezone string) error
+	UpdateAdSchedule(ctx context.Context, tweetId string, version *model.AdScheduleVersion) error
+	GetAdScheduleHistory(ctx context.Context, tweetId string) ([]model.AdScheduleVersion, error)
+	UpdateAdStatus(ctx context.Context, tweetId string, change *model.AdStatusChange) error
+	GetAdStatusHistory(ctx context.Context, tweetId string) ([]model.AdStatusChange, error)
+	UpdateAdTargeting(ctx context.Context, tweetId string, version *model.AdTargetingVersion) error
+	GetAdTargetingHistory(ctx context.Context, tweetId string) ([]model.AdTargetingVersion, error)
+	DeleteAdInfo(ctx context.Context, adInfo *model.AdInfo) error
+	GetAdsByOwner(ctx context.Context, owner string, pageSize int, pageState []byte) ([]string, []byte, error)
+	BackfillAdsByOwner(ctx context.Context) (int, error)
+	SaveCampaign(ctx context.Context, campaign *model.Campaign) error
+	GetCampaign(ctx context.Context, owner string, campaignId string) (*model.Campaign, error)
+	GetCampaigns(ctx context.Context, owner string) ([]model.Campaign, error)
+	DeleteCampaign(ctx context.Context, owner string, campaignId string) error
+	SetAdCampaign(ctx context.Context, tweetId string, previousCampaignId string, campaignId string) error
+	GetCampaignTweetIds(ctx context.Context, campaignId string) ([]string, error)
 	SaveTweetLikedEvent(ctx context.Context, tweetLikedEvent *model.TweetLikedEvent) error
 	SaveTweetUnlikedEvent(ctx context.Context, tweetUnlikedEvent *model.TweetUnlikedEvent) error
 	SaveTweetViewedEvent(ctx context.Context, tweetViewedEvent *model.TweetViewedEvent) error
 	SaveProfileVisitedEvent(ctx context.Context, profileVisitedEvent *model.ProfileVisitedEvent) error
+	SaveTweetClickedEvent(ctx context.Context, tweetClickedEvent *model.TweetClickedEvent) error
+	SaveTweetConversionEvent(ctx context.Context, tweetConversionEvent *model.TweetConversionEvent) error
+	SaveEvents(ctx context.Context, events []model.ReportEvent) []error
+	SaveViewerDemographics(ctx context.Context, username string, demographics *model.Demographics) error
+	GetViewerDemographics(ctx context.Context, username string) (*model.Demographics, error)
 	GetAverageTweetViewTime(ctx context.Context, tweetId gocql.UUID, from time.Time, to time.Time) (int, error)
+	GetTweetViewTimeTotals(ctx context.Context, tweetId gocql.UUID, from time.Time, to time.Time) (int64, int, error)
+	GetAdTweetIds(ctx context.Context) ([]string, error)
+	ClaimEventKey(ctx context.Context, tweetId gocql.UUID, kind string, username string, eventKey string, window time.Duration) (bool, error)
+	ReleaseEventKey(ctx context.Context, tweetId gocql.UUID, kind string, username string, eventKey string) error
+	SaveTouchpoint(ctx context.Context, tweetId gocql.UUID, username string, kind string, at time.Time, ttl time.Duration) error
+	HasTouchpoint(ctx context.Context, tweetId gocql.UUID, username string, kind string, from time.Time, to time.Time) (bool, error)
+	GetTweetEvents(ctx context.Context, tweetId gocql.UUID, from time.Time, to time.Time) ([]model.ReportEvent, error)
 }
@@ -3,23 +3,35 @@ package mongo
 import (
 	"context"
 	"fmt"
+	"github.com/FTN-TwitterClone/ads/histogram"
+	"github.com/FTN-TwitterClone/ads/hll"
 	"github.com/FTN-TwitterClone/ads/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	MONTHLY = "monthly"
-	DAILY   = "daily"
+	MONTHLY = model.MONTHLY
+	DAILY   = model.DAILY
+	HOURLY  = model.HOURLY
 )
 
+const defaultHourlyRetentionDays = 90
+
 type MongoReportsRepository struct {
 	tracer trace.Tracer
 	cli    *mongo.Client
+	// hourlyRetention is how long hourly reports are kept
+	hourlyRetention time.Duration
 }
 
 func NewMongoReportsRepository(tracer trace.Tracer) (*MongoReportsRepository, error) {
@@ -33,16 +45,234 @@ func NewMongoReportsRepository(tracer trace.Tracer) (*MongoReportsRepository, er
 	if err != nil {
 		panic(err)
 	}
-	client.Database("reportsDB").Collection("reports")
+	retentionDays, err := hourlyRetentionDays()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ensureHourlyRetention(client.Database("reportsDB").Collection("reports"), retentionDays)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ensureUniqueReportKeys(client.Database("reportsDB").Collection("reports"))
+	if err != nil {
+		return nil, err
+	}
 
 	car := MongoReportsRepository{
 		tracer,
 		client,
+		time.Duration(retentionDays) * 24 * time.Hour,
 	}
 
 	return &car, nil
 }
 
+// hourlyRetentionDays is how many days hourly reports are kept, HOURLY_REPORTS_RETENTION_DAYS or 90 by default.
+func hourlyRetentionDays() (int, error) {
+	v := os.Getenv("HOURLY_REPORTS_RETENTION_DAYS")
+	if v == "" {
+		return defaultHourlyRetentionDays, nil
+	}
+
+	days, err := strconv.Atoi(v)
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("invalid HOURLY_REPORTS_RETENTION_DAYS %q", v)
+	}
+
+	return days, nil
+}
+
+// ensureHourlyRetention keeps hourly reports for retentionDays days with a TTL index on their bucket start.
+func ensureHourlyRetention(collection *mongo.Collection, retentionDays int) error {
+	index := mongo.IndexModel{
+		Keys: bson.D{{"bucketStart", 1}},
+		Options: options.Index().
+			SetName("hourly_retention").
+			SetExpireAfterSeconds(int32(retentionDays * 24 * 60 * 60)).
+			SetPartialFilterExpression(bson.M{"type": HOURLY}),
+	}
+
+	// an existing index with a different TTL makes CreateOne fail with IndexOptionsConflict, so recreate it
+	_, err := collection.Indexes().CreateOne(context.TODO(), index)
+	if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.HasErrorCode(85) {
+		_, err = collection.Indexes().DropOne(context.TODO(), "hourly_retention")
+		if err != nil {
+			return err
+		}
+		_, err = collection.Indexes().CreateOne(context.TODO(), index)
+	}
+
+	return err
+}
+
+// ensureUniqueReportKeys keeps one document per report, concurrent upserts of a new report would otherwise each insert
+// one. Reports that are already duplicated are left as they are until their months are rebuilt, the index is created
+// on the first start after that.
+func ensureUniqueReportKeys(collection *mongo.Collection) error {
+	index := mongo.IndexModel{
+		Keys: bson.D{{"tweetId", 1}, {"type", 1}, {"year", 1}, {"month", 1}, {"day", 1}, {"hour", 1}},
+		Options: options.Index().
+			SetName("report_key").
+			SetUnique(true),
+	}
+
+	_, err := collection.Indexes().CreateOne(context.TODO(), index)
+	if mongo.IsDuplicateKeyError(err) {
+		log.Printf("reports are duplicated, rebuild their months to keep one per report: %v", err)
+		return nil
+	}
+
+	return err
+}
+
+// reportDocument is a stored report with the sketches its unique reach and view time distribution are estimated from.
+type reportDocument struct {
+	model.Report      `bson:",inline"`
+	ViewersSketch     hll.Registers    `bson:"viewersSketch"`
+	VisitorsSketch    hll.Registers    `bson:"visitorsSketch"`
+	LikersSketch      hll.Registers    `bson:"likersSketch"`
+	ViewTimeHistogram histogram.Counts `bson:"viewTimeHistogram"`
+}
+
+func (d *reportDocument) toReport() *model.Report {
+	report := d.Report
+	report.UniqueViewers = d.ViewersSketch.Estimate()
+	report.UniqueProfileVisitors = d.VisitorsSketch.Estimate()
+	report.UniqueLikers = d.LikersSketch.Estimate()
+	applyViewTimeHistogram(&report, d.ViewTimeHistogram)
+	report.ComputeDerivedMetrics()
+	return &report
+}
+
+// bucketedReportDocument is a stored report with the start of the series bucket it falls in, when there is one.
+type bucketedReportDocument struct {
+	reportDocument `bson:",inline"`
+	Bucket         time.Time `bson:"bucket"`
+}
+
+// reportSum is a sum of stored reports with the merged sketches and histograms of every report it covers.
+type reportSum struct {
+	report            model.Report
+	bucket            time.Time
+	viewersSketch     hll.Registers
+	visitorsSketch    hll.Registers
+	likersSketch      hll.Registers
+	viewTimeHistogram histogram.Counts
+}
+
+func newReportSum(d *bucketedReportDocument) *reportSum {
+	return &reportSum{
+		report:            model.Report{TweetId: d.TweetId},
+		bucket:            d.Bucket,
+		viewersSketch:     hll.Registers{},
+		visitorsSketch:    hll.Registers{},
+		likersSketch:      hll.Registers{},
+		viewTimeHistogram: histogram.Counts{},
+	}
+}
+
+func (s *reportSum) add(d *reportDocument) {
+	r := &s.report
+	r.LikesCount += d.LikesCount
+	r.UnlikesCount += d.UnlikesCount
+	r.ProfileVisits += d.ProfileVisits
+	r.Impressions += d.Impressions
+	r.LateEvents += d.LateEvents
+	r.InactiveEvents += d.InactiveEvents
+	r.Clicks += d.Clicks
+	r.LinkClicks += d.LinkClicks
+	r.MediaClicks += d.MediaClicks
+	r.HashtagClicks += d.HashtagClicks
+	r.Conversions += d.Conversions
+	r.Retweets += d.Retweets
+	r.Replies += d.Replies
+	r.Follows += d.Follows
+	r.AttributedConversions += d.AttributedConversions
+	r.OrganicConversions += d.OrganicConversions
+	r.ViewTimeSum += d.ViewTimeSum
+	r.ViewCount += d.ViewCount
+
+	mergeRegisters(s.viewersSketch, d.ViewersSketch)
+	mergeRegisters(s.visitorsSketch, d.VisitorsSketch)
+	mergeRegisters(s.likersSketch, d.LikersSketch)
+	for k, v := range d.ViewTimeHistogram {
+		s.viewTimeHistogram[k] += v
+	}
+}
+
+// mergeRegisters merges from into to in place, hll.Merge would copy the sum for every report added.
+func mergeRegisters(to hll.Registers, from hll.Registers) {
+	for k, v := range from {
+		if v > to[k] {
+			to[k] = v
+		}
+	}
+}
+
+func (s *reportSum) toReport() *model.Report {
+	report := s.report
+	report.UniqueViewers = s.viewersSketch.Estimate()
+	report.UniqueProfileVisitors = s.visitorsSketch.Estimate()
+	report.UniqueLikers = s.likersSketch.Estimate()
+	applyViewTimeHistogram(&report, s.viewTimeHistogram)
+	report.ComputeDerivedMetrics()
+	return &report
+}
+
+func applyViewTimeHistogram(report *model.Report, counts histogram.Counts) {
+	report.ViewTimeMedian = counts.Percentile(50)
+	report.ViewTimeP90 = counts.Percentile(90)
+	report.ViewTimeP99 = counts.Percentile(99)
+	report.ViewTimeHistogram = counts.Buckets()
+}
+
+// sumReports reads the reports pipeline matches one at a time and adds each to the sum of the group key puts it in,
+// returning the sums in the order their groups were first read. Sketches and histograms are merged here instead of
+// being pushed into one $group document, which a long range or a large campaign grows past the document size limit.
+func sumReports(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline, key func(d *bucketedReportDocument) interface{}) ([]*reportSum, error) {
+	// audience breakdowns aren't summed, so they aren't read
+	pipeline = append(pipeline, bson.D{{"$project", bson.M{"audience": 0}}})
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	groups := map[interface{}]*reportSum{}
+	var sums []*reportSum
+
+	for cursor.Next(ctx) {
+		var doc bucketedReportDocument
+
+		err = cursor.Decode(&doc)
+		if err != nil {
+			return nil, err
+		}
+
+		sum, ok := groups[key(&doc)]
+		if !ok {
+			sum = newReportSum(&doc)
+			groups[key(&doc)] = sum
+			sums = append(sums, sum)
+		}
+		sum.add(&doc.reportDocument)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return sums, nil
+}
+
+// oneGroup puts every report in the same sum.
+func oneGroup(*bucketedReportDocument) interface{} {
+	return nil
+}
+
 func (r *MongoReportsRepository) GetMonthlyReport(ctx context.Context, tweetId string, year int64, month int64) (*model.Report, error) {
 	_, span := r.tracer.Start(ctx, "MongoReportsRepository.GetMonthlyReport")
 	defer span.End()
@@ -51,7 +281,7 @@ func (r *MongoReportsRepository) GetMonthlyReport(ctx context.Context, tweetId s
 
 	filter := bson.M{"tweetId": tweetId, "type": MONTHLY, "year": year, "month": month}
 
-	var report model.Report
+	var report reportDocument
 
 	res := usersCollection.FindOne(ctx, filter)
 	if err := res.Err(); err != nil {
@@ -64,7 +294,7 @@ func (r *MongoReportsRepository) GetMonthlyReport(ctx context.Context, tweetId s
 		return nil, err
 	}
 
-	return &report, nil
+	return report.toReport(), nil
 }
 
 func (r *MongoReportsRepository) GetDailyReport(ctx context.Context, tweetId string, year int64, month int64, day int64) (*model.Report, error) {
@@ -75,7 +305,7 @@ func (r *MongoReportsRepository) GetDailyReport(ctx context.Context, tweetId str
 
 	filter := bson.M{"tweetId": tweetId, "type": DAILY, "year": year, "month": month, "day": day}
 
-	var report model.Report
+	var report reportDocument
 
 	res := usersCollection.FindOne(ctx, filter)
 	if err := res.Err(); err != nil {
@@ -88,81 +318,473 @@ func (r *MongoReportsRepository) GetDailyReport(ctx context.Context, tweetId str
 		return nil, err
 	}
 
-	return &report, nil
+	return report.toReport(), nil
 }
 
-func (r *MongoReportsRepository) UpsertMonthlyReportLikesCount(ctx context.Context, tweetId string, year int64, month int64) error {
-	_, span := r.tracer.Start(ctx, "MongoReportsRepository.UpsertMonthlyReportLikesCount")
+func (r *MongoReportsRepository) GetHourlyReport(ctx context.Context, tweetId string, year int64, month int64, day int64, hour int64) (*model.Report, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.GetHourlyReport")
 	defer span.End()
 
 	usersCollection := r.cli.Database("reportsDB").Collection("reports")
 
-	filter := bson.M{"tweetId": tweetId, "type": MONTHLY, "year": year, "month": month}
-	update := bson.D{{"$inc", bson.D{{"likesCount", 1}}}}
-	setUpsert := options.Update().SetUpsert(true)
+	filter := bson.M{"tweetId": tweetId, "type": HOURLY, "year": year, "month": month, "day": day, "hour": hour}
 
-	_, err := usersCollection.UpdateOne(ctx, filter, update, setUpsert)
+	var report reportDocument
 
+	res := usersCollection.FindOne(ctx, filter)
+	if err := res.Err(); err != nil {
+		return nil, nil
+	}
+
+	err := res.Decode(&report)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return err
+		return nil, err
 	}
 
-	return nil
+	return report.toReport(), nil
 }
 
-func (r *MongoReportsRepository) UpsertMonthlyReportUnlikesCount(ctx context.Context, tweetId string, year int64, month int64) error {
-	_, span := r.tracer.Start(ctx, "MongoReportsRepository.UpsertMonthlyReportUnlikesCount")
+// GetRangeReport sums the daily reports of a tweet for every day from the day of from up to and including the day of to.
+func (r *MongoReportsRepository) GetRangeReport(ctx context.Context, tweetId string, from time.Time, to time.Time) (*model.Report, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.GetRangeReport")
 	defer span.End()
 
 	usersCollection := r.cli.Database("reportsDB").Collection("reports")
 
-	filter := bson.M{"tweetId": tweetId, "type": MONTHLY, "year": year, "month": month}
-	update := bson.D{{"$inc", bson.D{{"unlikesCount", 1}}}}
-	setUpsert := options.Update().SetUpsert(true)
+	sums, err := sumReports(ctx, usersCollection, dailyRangeStages(tweetId, from, to), oneGroup)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	if len(sums) == 0 {
+		return &model.Report{TweetId: tweetId}, nil
+	}
+
+	report := sums[0].toReport()
+	report.TweetId = tweetId
+
+	return report, nil
+}
 
-	_, err := usersCollection.UpdateOne(ctx, filter, update, setUpsert)
+func (r *MongoReportsRepository) GetCampaignMonthlyReport(ctx context.Context, tweetIds []string, year int64, month int64) (*model.CampaignReport, error) {
+	serviceCtx, span := r.tracer.Start(ctx, "MongoReportsRepository.GetCampaignMonthlyReport")
+	defer span.End()
 
+	report, err := r.campaignReport(serviceCtx, bson.M{"tweetId": bson.M{"$in": tweetIds}, "type": MONTHLY, "year": year, "month": month})
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return err
+		return nil, err
 	}
 
-	return nil
+	report.Year = year
+	report.Month = month
+
+	return report, nil
 }
 
-func (r *MongoReportsRepository) UpsertMonthlyReportProfileVisitsCount(ctx context.Context, tweetId string, year int64, month int64) error {
-	_, span := r.tracer.Start(ctx, "MongoReportsRepository.UpsertMonthlyReportProfileVisitsCount")
+func (r *MongoReportsRepository) GetCampaignDailyReport(ctx context.Context, tweetIds []string, year int64, month int64, day int64) (*model.CampaignReport, error) {
+	serviceCtx, span := r.tracer.Start(ctx, "MongoReportsRepository.GetCampaignDailyReport")
 	defer span.End()
 
+	report, err := r.campaignReport(serviceCtx, bson.M{"tweetId": bson.M{"$in": tweetIds}, "type": DAILY, "year": year, "month": month, "day": day})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	report.Year = year
+	report.Month = month
+	report.Day = day
+
+	return report, nil
+}
+
+// campaignReport reads the reports matching filter, one per tweet, and sums them. Unique reach is merged across
+// tweets, so a viewer who saw several tweets of the campaign is counted once.
+func (r *MongoReportsRepository) campaignReport(ctx context.Context, filter bson.M) (*model.CampaignReport, error) {
 	usersCollection := r.cli.Database("reportsDB").Collection("reports")
 
-	filter := bson.M{"tweetId": tweetId, "type": MONTHLY, "year": year, "month": month}
-	update := bson.D{{"$inc", bson.D{{"profileVisits", 1}}}}
-	setUpsert := options.Update().SetUpsert(true)
+	cursor, err := usersCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"tweetId": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []reportDocument
+
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.CampaignReport{Tweets: make([]model.Report, len(docs))}
+	total := newReportSum(&bucketedReportDocument{})
+	for i := range docs {
+		report.Tweets[i] = *docs[i].toReport()
+		total.add(&docs[i])
+	}
+
+	if len(docs) > 0 {
+		report.Total = *total.toReport()
+	}
+
+	return report, nil
+}
+
+// GetLifetimeReports sums the monthly reports of each of the tweets, tweets without reports are left out.
+func (r *MongoReportsRepository) GetLifetimeReports(ctx context.Context, tweetIds []string) ([]model.Report, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.GetLifetimeReports")
+	defer span.End()
+
+	usersCollection := r.cli.Database("reportsDB").Collection("reports")
 
-	_, err := usersCollection.UpdateOne(ctx, filter, update, setUpsert)
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.M{"tweetId": bson.M{"$in": tweetIds}, "type": MONTHLY}}},
+	}
 
+	sums, err := sumReports(ctx, usersCollection, pipeline, func(d *bucketedReportDocument) interface{} {
+		return d.TweetId
+	})
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return err
+		return nil, err
 	}
 
-	return nil
+	reports := make([]model.Report, len(sums))
+	for i, sum := range sums {
+		reports[i] = *sum.toReport()
+	}
+
+	return reports, nil
 }
 
-func (r *MongoReportsRepository) UpsertMonthlyReportAverageProfileViewTime(ctx context.Context, tweetId string, year int64, month int64, averageViewTime int64) error {
-	_, span := r.tracer.Start(ctx, "MongoReportsRepository.UpsertMonthlyReportAverageProfileViewTime")
+// GetAudienceBreakdown sums the audience counters of the daily reports of a tweet for every day from the day of from up to and including the day of to.
+func (r *MongoReportsRepository) GetAudienceBreakdown(ctx context.Context, tweetId string, from time.Time, to time.Time) (*model.AudienceBreakdown, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.GetAudienceBreakdown")
 	defer span.End()
 
 	usersCollection := r.cli.Database("reportsDB").Collection("reports")
 
-	filter := bson.M{"tweetId": tweetId, "type": MONTHLY, "year": year, "month": month}
-	update := bson.D{{"$set", bson.D{{"averageViewTime", averageViewTime}}}}
-	setUpsert := options.Update().SetUpsert(true)
+	pipeline := append(dailyRangeStages(tweetId, from, to),
+		bson.D{{"$project", bson.M{"audience": 1}}},
+	)
+
+	cursor, err := usersCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	var docs []struct {
+		Audience model.AudienceBreakdown `bson:"audience"`
+	}
+
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	breakdown := model.AudienceBreakdown{
+		TweetId:    tweetId,
+		AgeBracket: map[string]model.EngagementCounts{},
+		Gender:     map[string]model.EngagementCounts{},
+		Town:       map[string]model.EngagementCounts{},
+	}
+
+	for _, d := range docs {
+		addEngagementCounts(breakdown.AgeBracket, d.Audience.AgeBracket)
+		addEngagementCounts(breakdown.Gender, d.Audience.Gender)
+		addEngagementCounts(breakdown.Town, d.Audience.Town)
+		breakdown.OnTarget = sumEngagementCounts(breakdown.OnTarget, d.Audience.OnTarget)
+		breakdown.Total = sumEngagementCounts(breakdown.Total, d.Audience.Total)
+	}
+
+	return &breakdown, nil
+}
+
+// GetDeliveredHours counts the hourly reports of a tweet with impressions for every day from the day of from up to and
+// including the day of to. It returns nil when the period starts before the hourly retention, those hours are gone.
+func (r *MongoReportsRepository) GetDeliveredHours(ctx context.Context, tweetId string, from time.Time, to time.Time) (*int, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.GetDeliveredHours")
+	defer span.End()
+
+	// hourly reports expire by their bucket start, which holds the hour's calendar parts as UTC
+	firstBucket := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	if firstBucket.Before(time.Now().Add(-r.hourlyRetention)) {
+		return nil, nil
+	}
+
+	usersCollection := r.cli.Database("reportsDB").Collection("reports")
+
+	pipeline := append(hourlyRangeStages(tweetId, from, to),
+		bson.D{{"$match", bson.M{"impressions": bson.M{"$gt": 0}}}},
+		bson.D{{"$count", "hours"}},
+	)
+
+	cursor, err := usersCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	var docs []struct {
+		Hours int `bson:"hours"`
+	}
+
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	hours := 0
+	if len(docs) > 0 {
+		hours = docs[0].Hours
+	}
+
+	return &hours, nil
+}
+
+func addEngagementCounts(to map[string]model.EngagementCounts, from map[string]model.EngagementCounts) {
+	for k, v := range from {
+		to[k] = sumEngagementCounts(to[k], v)
+	}
+}
+
+func sumEngagementCounts(a model.EngagementCounts, b model.EngagementCounts) model.EngagementCounts {
+	return model.EngagementCounts{
+		Likes:  a.Likes + b.Likes,
+		Views:  a.Views + b.Views,
+		Visits: a.Visits + b.Visits,
+	}
+}
+
+// GetReportSeries sums the daily reports of a tweet into week or month buckets (or returns daily and hourly reports as they are).
+// Only non-empty buckets are returned, ordered by bucket start, with year, month, day and hour set to the start of the bucket.
+func (r *MongoReportsRepository) GetReportSeries(ctx context.Context, tweetId string, from time.Time, to time.Time, granularity string) ([]model.Report, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.GetReportSeries")
+	defer span.End()
+
+	usersCollection := r.cli.Database("reportsDB").Collection("reports")
+
+	stages := dailyRangeStages(tweetId, from, to)
+
+	var bucket interface{}
+	switch granularity {
+	case model.HOUR:
+		stages = hourlyRangeStages(tweetId, from, to)
+		bucket = "$date"
+	case model.DAY:
+		bucket = "$date"
+	case model.WEEK:
+		// ISO weeks start on Monday
+		bucket = bson.M{"$subtract": bson.A{"$date", bson.M{"$multiply": bson.A{bson.M{"$subtract": bson.A{bson.M{"$isoDayOfWeek": "$date"}, 1}}, 24 * 60 * 60 * 1000}}}}
+	case model.MONTH:
+		bucket = bson.M{"$dateFromParts": bson.M{"year": "$year", "month": "$month", "day": 1}}
+	default:
+		err := fmt.Errorf("unsupported granularity %s", granularity)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	pipeline := append(stages, bson.D{{"$addFields", bson.M{"bucket": bucket}}})
+
+	sums, err := sumReports(ctx, usersCollection, pipeline, func(d *bucketedReportDocument) interface{} {
+		return d.Bucket.UnixNano()
+	})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	sort.Slice(sums, func(i, j int) bool {
+		return sums[i].bucket.Before(sums[j].bucket)
+	})
+
+	reports := make([]model.Report, len(sums))
+	for i, sum := range sums {
+		reports[i] = *sum.toReport()
+		reports[i].TweetId = tweetId
+		reports[i].Year = int64(sum.bucket.Year())
+		reports[i].Month = int64(sum.bucket.Month())
+		reports[i].Day = int64(sum.bucket.Day())
+		reports[i].Hour = int64(sum.bucket.Hour())
+	}
+
+	return reports, nil
+}
+
+// hourlyRangeStages matches the hourly reports of a tweet for every hour of the days from the day of from up to and including the day of to.
+func hourlyRangeStages(tweetId string, from time.Time, to time.Time) mongo.Pipeline {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, time.UTC)
 
-	_, err := usersCollection.UpdateOne(ctx, filter, update, setUpsert)
+	return mongo.Pipeline{
+		{{"$match", bson.M{"tweetId": tweetId, "type": HOURLY}}},
+		{{"$addFields", bson.M{"date": bson.M{"$dateFromParts": bson.M{"year": "$year", "month": "$month", "day": "$day", "hour": "$hour"}}}}},
+		{{"$match", bson.M{"date": bson.M{"$gte": fromDate, "$lt": toDate}}}},
+	}
+}
+
+// dailyRangeStages matches the daily reports of a tweet for every day from the day of from up to and including the day of to.
+// $dateFromParts builds UTC dates, so day boundaries are compared on calendar parts only.
+func dailyRangeStages(tweetId string, from time.Time, to time.Time) mongo.Pipeline {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+
+	return mongo.Pipeline{
+		{{"$match", bson.M{"tweetId": tweetId, "type": DAILY}}},
+		{{"$addFields", bson.M{"date": bson.M{"$dateFromParts": bson.M{"year": "$year", "month": "$month", "day": "$day"}}}}},
+		{{"$match", bson.M{"date": bson.M{"$gte": fromDate, "$lte": toDate}}}},
+	}
+}
+
+const maxWriteAttempts = 5
+
+// reportUpdate collects what a batch of events changes in one report.
+type reportUpdate struct {
+	key model.ReportKey
+	inc bson.D
+	max bson.D
+}
+
+func (u *reportUpdate) writeModel() mongo.WriteModel {
+	update := bson.D{{"$inc", u.inc}}
+	if len(u.max) > 0 {
+		update = append(update, bson.E{"$max", u.max})
+	}
+	if u.key.Type == HOURLY {
+		update = append(update, hourlyBucketStart(u.key.Year, u.key.Month, u.key.Day, u.key.Hour))
+	}
+
+	return mongo.NewUpdateOneModel().
+		SetFilter(reportKeyFilter(u.key)).
+		SetUpdate(update).
+		SetUpsert(true)
+}
+
+// ApplyReportEvents counts events in their monthly, daily and hourly reports with one bulk write,
+// merging the changes of events that land in the same report. Writes the server rejected are retried on their own
+// so the reports that were already updated aren't counted twice, any other error is returned without retrying.
+func (r *MongoReportsRepository) ApplyReportEvents(ctx context.Context, events []model.ReportEvent) error {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.ApplyReportEvents")
+	defer span.End()
+
+	usersCollection := r.cli.Database("reportsDB").Collection("reports")
+
+	updates := map[model.ReportKey]*reportUpdate{}
+	var keys []model.ReportKey
+
+	update := func(key model.ReportKey) *reportUpdate {
+		u, ok := updates[key]
+		if !ok {
+			u = &reportUpdate{key: key}
+			updates[key] = u
+			keys = append(keys, key)
+		}
+		return u
+	}
+
+	for _, e := range events {
+		t := e.Time
+		monthly := update(model.ReportKey{TweetId: e.TweetId, Type: MONTHLY, Year: int64(t.Year()), Month: int64(t.Month())})
+		daily := update(model.ReportKey{TweetId: e.TweetId, Type: DAILY, Year: int64(t.Year()), Month: int64(t.Month()), Day: int64(t.Day())})
+		hourly := update(model.ReportKey{TweetId: e.TweetId, Type: HOURLY, Year: int64(t.Year()), Month: int64(t.Month()), Day: int64(t.Day()), Hour: int64(t.Hour())})
+
+		// late events are only counted apart, in the reports of when they arrived
+		if e.Late {
+			for _, u := range []*reportUpdate{monthly, daily, hourly} {
+				u.inc = append(u.inc, bson.E{"lateEvents", 1})
+			}
+			continue
+		}
+
+		// so are events of ads that weren't active, in the reports of when they happened
+		if e.Inactive {
+			for _, u := range []*reportUpdate{monthly, daily, hourly} {
+				u.inc = append(u.inc, bson.E{"inactiveEvents", 1})
+			}
+			continue
+		}
+
+		for _, u := range []*reportUpdate{monthly, daily, hourly} {
+			u.inc = append(u.inc, eventCounters(e)...)
+		}
+
+		if sketch := eventSketch(e.Kind); sketch != "" {
+			register, rank := hll.Register(e.Username)
+			for _, u := range []*reportUpdate{monthly, daily, hourly} {
+				u.max = append(u.max, bson.E{sketch + "." + register, rank})
+			}
+		}
+
+		// histograms and audience are only kept for months and days
+		for _, u := range []*reportUpdate{monthly, daily} {
+			u.inc = append(u.inc, eventDistributions(e)...)
+		}
+	}
+
+	writes := make([]mongo.WriteModel, len(keys))
+	for i, k := range keys {
+		u := updates[k]
+		u.inc = mergeIncrements(u.inc)
+		u.max = mergeMaximums(u.max)
+		writes[i] = u.writeModel()
+	}
 
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		_, err := usersCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		if err == nil {
+			return nil
+		}
+
+		// only writes the server rejected are known not to be applied, after any other error some of the increments
+		// may have been, and sending them again would count them twice
+		bulkErr, ok := err.(mongo.BulkWriteException)
+		if !ok || bulkErr.WriteConcernError != nil || attempt == maxWriteAttempts {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		failed := make([]mongo.WriteModel, 0, len(bulkErr.WriteErrors))
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed = append(failed, writes[writeErr.Index])
+		}
+		writes = failed
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			span.SetStatus(codes.Error, ctx.Err().Error())
+			return ctx.Err()
+		}
+	}
+}
+
+// SaveDeadLetters records the months of reports a failed batch of events belonged to, a month that's already recorded
+// adds the events and keeps the latest failure.
+func (r *MongoReportsRepository) SaveDeadLetters(ctx context.Context, letters []model.DeadLetter) error {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.SaveDeadLetters")
+	defer span.End()
+
+	deadLetters := r.cli.Database("reportsDB").Collection("dead_letters")
+
+	writes := make([]mongo.WriteModel, len(letters))
+	for i, l := range letters {
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"tweetId": l.TweetId, "year": l.Year, "month": l.Month}).
+			SetUpdate(bson.D{
+				{"$inc", bson.D{{"events", l.Events}}},
+				{"$set", bson.D{{"failedAt", l.FailedAt}, {"error", l.Error}}},
+			}).
+			SetUpsert(true)
+	}
+
+	_, err := deadLetters.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return err
@@ -171,18 +793,65 @@ func (r *MongoReportsRepository) UpsertMonthlyReportAverageProfileViewTime(ctx c
 	return nil
 }
 
-func (r *MongoReportsRepository) UpsertDailyReportLikesCount(ctx context.Context, tweetId string, year int64, month int64, day int64) error {
-	_, span := r.tracer.Start(ctx, "MongoReportsRepository.UpsertDailyReportLikesCount")
+func (r *MongoReportsRepository) GetDeadLetters(ctx context.Context) ([]model.DeadLetter, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.GetDeadLetters")
 	defer span.End()
 
-	usersCollection := r.cli.Database("reportsDB").Collection("reports")
+	deadLetters := r.cli.Database("reportsDB").Collection("dead_letters")
 
-	filter := bson.M{"tweetId": tweetId, "type": DAILY, "year": year, "month": month, "day": day}
-	update := bson.D{{"$inc", bson.D{{"likesCount", 1}}}}
-	setUpsert := options.Update().SetUpsert(true)
+	cursor, err := deadLetters.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{"failedAt", 1}}))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	letters := []model.DeadLetter{}
+	err = cursor.All(ctx, &letters)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return letters, nil
+}
+
+// ClaimDeadLetter takes a month for recounting until the given time, so replicas don't rebuild the same month at once.
+// It returns false when another replica holds the month.
+func (r *MongoReportsRepository) ClaimDeadLetter(ctx context.Context, letter *model.DeadLetter, until time.Time) (bool, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.ClaimDeadLetter")
+	defer span.End()
+
+	deadLetters := r.cli.Database("reportsDB").Collection("dead_letters")
+
+	filter := bson.M{
+		"tweetId": letter.TweetId,
+		"year":    letter.Year,
+		"month":   letter.Month,
+		"$or": bson.A{
+			bson.M{"claimedUntil": bson.M{"$exists": false}},
+			bson.M{"claimedUntil": bson.M{"$lte": time.Now()}},
+		},
+	}
+
+	result, err := deadLetters.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"claimedUntil": until}})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// DeleteDeadLetter removes a month once it's recounted, unless another batch of it failed after letter was read.
+func (r *MongoReportsRepository) DeleteDeadLetter(ctx context.Context, letter *model.DeadLetter) error {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.DeleteDeadLetter")
+	defer span.End()
 
-	_, err := usersCollection.UpdateOne(ctx, filter, update, setUpsert)
+	deadLetters := r.cli.Database("reportsDB").Collection("dead_letters")
 
+	filter := bson.M{"tweetId": letter.TweetId, "year": letter.Year, "month": letter.Month, "failedAt": bson.M{"$lte": letter.FailedAt}}
+
+	_, err := deadLetters.DeleteOne(ctx, filter)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return err
@@ -191,17 +860,216 @@ func (r *MongoReportsRepository) UpsertDailyReportLikesCount(ctx context.Context
 	return nil
 }
 
-func (r *MongoReportsRepository) UpsertDailyReportUnlikesCount(ctx context.Context, tweetId string, year int64, month int64, day int64) error {
-	_, span := r.tracer.Start(ctx, "MongoReportsRepository.UpsertDailyReportUnlikesCount")
+func eventCounters(e model.ReportEvent) bson.D {
+	return append(kindCounters(e), attributionCounter(e)...)
+}
+
+func attributionCounter(e model.ReportEvent) bson.D {
+	switch e.Kind {
+	case model.VISIT_EVENT, model.LIKE_EVENT, model.CONVERSION_EVENT:
+		if e.Attributed {
+			return bson.D{{"attributedConversions", 1}}
+		}
+		return bson.D{{"organicConversions", 1}}
+	}
+	return nil
+}
+
+func kindCounters(e model.ReportEvent) bson.D {
+	switch e.Kind {
+	case model.LIKE_EVENT:
+		return bson.D{{"likesCount", 1}}
+	case model.UNLIKE_EVENT:
+		return bson.D{{"unlikesCount", 1}}
+	case model.VISIT_EVENT:
+		return bson.D{{"profileVisits", 1}}
+	case model.VIEW_EVENT:
+		return bson.D{{"impressions", 1}, {"viewTimeSum", e.ViewTime}, {"viewCount", 1}}
+	case model.CLICK_EVENT:
+		return bson.D{{"clicks", 1}, {e.ClickType + "Clicks", 1}}
+	case model.CONVERSION_EVENT:
+		return bson.D{{"conversions", 1}, {conversionCounter(e.ConversionType), 1}}
+	}
+	return nil
+}
+
+func conversionCounter(conversionType string) string {
+	switch conversionType {
+	case model.RETWEET_CONVERSION:
+		return "retweets"
+	case model.REPLY_CONVERSION:
+		return "replies"
+	default:
+		return "follows"
+	}
+}
+
+func eventDistributions(e model.ReportEvent) bson.D {
+	var inc bson.D
+
+	if e.Kind == model.VIEW_EVENT {
+		inc = append(inc, bson.E{"viewTimeHistogram." + histogram.Key(e.ViewTime), 1})
+	}
+
+	if metric := audienceMetric(e.Kind); metric != "" {
+		inc = append(inc, audienceIncrements(metric, e.Segment)...)
+	}
+
+	return inc
+}
+
+func eventSketch(kind string) string {
+	switch kind {
+	case model.LIKE_EVENT:
+		return "likersSketch"
+	case model.VISIT_EVENT:
+		return "visitorsSketch"
+	case model.VIEW_EVENT:
+		return "viewersSketch"
+	}
+	return ""
+}
+
+func audienceMetric(kind string) string {
+	switch kind {
+	case model.LIKE_EVENT:
+		return model.LIKES
+	case model.VISIT_EVENT:
+		return model.VISITS
+	case model.VIEW_EVENT:
+		return model.VIEWS
+	}
+	return ""
+}
+
+func mergeIncrements(inc bson.D) bson.D {
+	merged := bson.D{}
+	index := map[string]int{}
+	for _, e := range inc {
+		i, ok := index[e.Key]
+		if !ok {
+			index[e.Key] = len(merged)
+			merged = append(merged, bson.E{e.Key, toInt64(e.Value)})
+			continue
+		}
+		merged[i].Value = merged[i].Value.(int64) + toInt64(e.Value)
+	}
+	return merged
+}
+
+func mergeMaximums(max bson.D) bson.D {
+	merged := bson.D{}
+	index := map[string]int{}
+	for _, e := range max {
+		i, ok := index[e.Key]
+		if !ok {
+			index[e.Key] = len(merged)
+			merged = append(merged, e)
+			continue
+		}
+		if e.Value.(int32) > merged[i].Value.(int32) {
+			merged[i].Value = e.Value
+		}
+	}
+	return merged
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	}
+	return 0
+}
+
+func audienceIncrements(metric string, segment model.AudienceSegment) bson.D {
+	inc := bson.D{
+		{"audience.ageBracket." + audienceKey(segment.AgeBracket) + "." + metric, 1},
+		{"audience.gender." + audienceKey(segment.Gender) + "." + metric, 1},
+		{"audience.town." + audienceKey(segment.Town) + "." + metric, 1},
+		{"audience.total." + metric, 1},
+	}
+
+	if segment.OnTarget {
+		inc = append(inc, bson.E{"audience.onTarget." + metric, 1})
+	}
+
+	return inc
+}
+
+// audienceKey makes a value usable as a field name, dots would nest and a leading $ is reserved.
+func audienceKey(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+
+	return strings.NewReplacer(".", "_", "$", "_").Replace(strings.ToLower(value))
+}
+
+// hourlyBucketStart stamps new hourly reports with the date their retention is counted from.
+func hourlyBucketStart(year int64, month int64, day int64, hour int64) bson.E {
+	start := time.Date(int(year), time.Month(month), int(day), int(hour), 0, 0, 0, time.UTC)
+	return bson.E{"$setOnInsert", bson.D{{"bucketStart", start}}}
+}
+
+// GetReportKeysWithoutViewTimeTotals returns the reports written before view time totals were kept that aren't backfilled yet.
+func (r *MongoReportsRepository) GetReportKeysWithoutViewTimeTotals(ctx context.Context) ([]model.ReportKey, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.GetReportKeysWithoutViewTimeTotals")
 	defer span.End()
 
 	usersCollection := r.cli.Database("reportsDB").Collection("reports")
 
-	filter := bson.M{"tweetId": tweetId, "type": DAILY, "year": year, "month": month, "day": day}
-	update := bson.D{{"$inc", bson.D{{"unlikesCount", 1}}}}
-	setUpsert := options.Update().SetUpsert(true)
+	filter := bson.M{"averageViewTime": bson.M{"$exists": true}, "viewTimeBackfilled": bson.M{"$exists": false}}
+	projection := options.Find().SetProjection(bson.M{"tweetId": 1, "type": 1, "year": 1, "month": 1, "day": 1, "hour": 1})
+
+	cursor, err := usersCollection.Find(ctx, filter, projection)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	var docs []struct {
+		TweetId string `bson:"tweetId"`
+		Type    string `bson:"type"`
+		Year    int64  `bson:"year"`
+		Month   int64  `bson:"month"`
+		Day     int64  `bson:"day"`
+		Hour    int64  `bson:"hour"`
+	}
+
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	keys := make([]model.ReportKey, len(docs))
+	for i, d := range docs {
+		keys[i] = model.ReportKey(d)
+	}
 
-	_, err := usersCollection.UpdateOne(ctx, filter, update, setUpsert)
+	return keys, nil
+}
+
+// BackfillReportViewTimeTotals adds view time totals of events counted before the totals were kept, at most once per report.
+func (r *MongoReportsRepository) BackfillReportViewTimeTotals(ctx context.Context, key model.ReportKey, viewTimeSum int64, viewCount int) error {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.BackfillReportViewTimeTotals")
+	defer span.End()
+
+	usersCollection := r.cli.Database("reportsDB").Collection("reports")
+
+	filter := reportKeyFilter(key)
+	filter["viewTimeBackfilled"] = bson.M{"$exists": false}
+	update := bson.D{
+		{"$inc", bson.D{{"viewTimeSum", viewTimeSum}, {"viewCount", viewCount}}},
+		{"$set", bson.D{{"viewTimeBackfilled", true}}},
+	}
+
+	_, err := usersCollection.UpdateOne(ctx, filter, update)
 
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
@@ -211,18 +1079,55 @@ func (r *MongoReportsRepository) UpsertDailyReportUnlikesCount(ctx context.Conte
 	return nil
 }
 
-func (r *MongoReportsRepository) UpsertDailyReportProfileVisitsCount(ctx context.Context, tweetId string, year int64, month int64, day int64) error {
-	_, span := r.tracer.Start(ctx, "MongoReportsRepository.UpsertDailyReportProfileVisitsCount")
+// SaveMigrationCutoff keeps the cutoff of a data migration the first time it's saved and returns the kept one, so
+// every run of the migration uses the same cutoff.
+func (r *MongoReportsRepository) SaveMigrationCutoff(ctx context.Context, name string, cutoff time.Time) (time.Time, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.SaveMigrationCutoff")
 	defer span.End()
 
-	usersCollection := r.cli.Database("reportsDB").Collection("reports")
+	migrations := r.cli.Database("reportsDB").Collection("migrations")
 
-	filter := bson.M{"tweetId": tweetId, "type": DAILY, "year": year, "month": month, "day": day}
-	update := bson.D{{"$inc", bson.D{{"profileVisits", 1}}}}
-	setUpsert := options.Update().SetUpsert(true)
+	res := migrations.FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{"$setOnInsert": bson.M{"cutoff": cutoff}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	)
 
-	_, err := usersCollection.UpdateOne(ctx, filter, update, setUpsert)
+	var migration struct {
+		Cutoff time.Time `bson:"cutoff"`
+	}
 
+	err := res.Decode(&migration)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return time.Time{}, err
+	}
+
+	return migration.Cutoff, nil
+}
+
+func reportKeyFilter(key model.ReportKey) bson.M {
+	filter := bson.M{"tweetId": key.TweetId, "type": key.Type, "year": key.Year, "month": key.Month}
+
+	switch key.Type {
+	case DAILY:
+		filter["day"] = key.Day
+	case HOURLY:
+		filter["day"] = key.Day
+		filter["hour"] = key.Hour
+	}
+
+	return filter
+}
+
+// DeleteMonthReports removes the monthly report of a tweet together with its daily and hourly reports in that month.
+func (r *MongoReportsRepository) DeleteMonthReports(ctx context.Context, tweetId string, year int64, month int64) error {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.DeleteMonthReports")
+	defer span.End()
+
+	usersCollection := r.cli.Database("reportsDB").Collection("reports")
+
+	_, err := usersCollection.DeleteMany(ctx, bson.M{"tweetId": tweetId, "year": year, "month": month})
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return err
@@ -231,18 +1136,49 @@ func (r *MongoReportsRepository) UpsertDailyReportProfileVisitsCount(ctx context
 	return nil
 }
 
-func (r *MongoReportsRepository) UpsertDailyReportAverageProfileViewTime(ctx context.Context, tweetId string, year int64, month int64, day int64, averageViewTime int64) error {
-	_, span := r.tracer.Start(ctx, "MongoReportsRepository.UpsertDailyReportAverageProfileViewTime")
+// ArchiveReports moves the daily and monthly reports of a deleted ad to archived_reports and keeps the ad in
+// archived_ads, its hourly reports are dropped. Archiving an ad again replaces what was archived of it.
+func (r *MongoReportsRepository) ArchiveReports(ctx context.Context, ad *model.ArchivedAd) error {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.ArchiveReports")
 	defer span.End()
 
 	usersCollection := r.cli.Database("reportsDB").Collection("reports")
+	archivedReports := r.cli.Database("reportsDB").Collection("archived_reports")
+	archivedAds := r.cli.Database("reportsDB").Collection("archived_ads")
 
-	filter := bson.M{"tweetId": tweetId, "type": DAILY, "year": year, "month": month, "day": day}
-	update := bson.D{{"$set", bson.D{{"averageViewTime", averageViewTime}}}}
-	setUpsert := options.Update().SetUpsert(true)
+	_, err := archivedAds.ReplaceOne(ctx, bson.M{"tweetId": ad.TweetId}, ad, options.Replace().SetUpsert(true))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	cursor, err := usersCollection.Find(ctx, bson.M{"tweetId": ad.TweetId, "type": bson.M{"$ne": HOURLY}})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
 
-	_, err := usersCollection.UpdateOne(ctx, filter, update, setUpsert)
+	var docs []bson.M
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if len(docs) > 0 {
+		writes := make([]mongo.WriteModel, len(docs))
+		for i, d := range docs {
+			writes[i] = mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": d["_id"]}).SetReplacement(d).SetUpsert(true)
+		}
+
+		_, err = archivedReports.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
 
+	_, err = usersCollection.DeleteMany(ctx, bson.M{"tweetId": ad.TweetId})
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return err
@@ -250,3 +1186,102 @@ func (r *MongoReportsRepository) UpsertDailyReportAverageProfileViewTime(ctx con
 
 	return nil
 }
+
+// RepairReportCounters sets the counters of a daily report to counted if they still hold reported, and moves its
+// monthly report by the difference. It reports whether the daily report was repaired, one that changed since it was
+// read is left alone, so reconcilers running on several replicas correct a report once. Hourly reports aren't repaired.
+// A monthly report that can't be moved is recorded as a dead letter, so its month is rebuilt.
+func (r *MongoReportsRepository) RepairReportCounters(ctx context.Context, tweetId string, year int64, month int64, day int64, reported *model.Report, counted *model.Report) (bool, error) {
+	_, span := r.tracer.Start(ctx, "MongoReportsRepository.RepairReportCounters")
+	defer span.End()
+
+	usersCollection := r.cli.Database("reportsDB").Collection("reports")
+
+	dailyKey := model.ReportKey{TweetId: tweetId, Type: DAILY, Year: year, Month: month, Day: day}
+
+	// a daily report without events doesn't exist yet, it's created the way events create it
+	_, err := usersCollection.UpdateOne(ctx, reportKeyFilter(dailyKey), bson.D{{"$inc", bson.D{{"likesCount", 0}}}}, options.Update().SetUpsert(true))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+
+	filter := reportKeyFilter(dailyKey)
+	set := bson.D{}
+	inc := bson.D{}
+	reportedCounters := reportCounterValues(reported)
+	for i, c := range reportCounterValues(counted) {
+		value := toInt64(reportedCounters[i].Value)
+		if value == 0 {
+			// counters are only stored once something was counted in them
+			filter[c.Key] = bson.M{"$in": bson.A{0, nil}}
+		} else {
+			filter[c.Key] = value
+		}
+
+		set = append(set, c)
+		if diff := toInt64(c.Value) - value; diff != 0 {
+			inc = append(inc, bson.E{c.Key, diff})
+		}
+	}
+
+	if len(inc) == 0 {
+		return false, nil
+	}
+
+	result, err := usersCollection.UpdateOne(ctx, filter, bson.D{{"$set", set}})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+
+	if result.ModifiedCount == 0 {
+		return false, nil
+	}
+
+	monthly := &reportUpdate{key: model.ReportKey{TweetId: tweetId, Type: MONTHLY, Year: year, Month: month}, inc: inc}
+	_, err = usersCollection.BulkWrite(ctx, []mongo.WriteModel{monthly.writeModel()})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+
+		// the daily report no longer shows the drift, so the month is recounted instead of repaired on the next run
+		deadLetterErr := r.SaveDeadLetters(ctx, []model.DeadLetter{{
+			TweetId:  tweetId,
+			Year:     year,
+			Month:    month,
+			FailedAt: time.Now(),
+			Error:    err.Error(),
+		}})
+		if deadLetterErr != nil {
+			log.Printf("Monthly report of tweet %s in %04d-%02d wasn't repaired, rebuild the month: %s", tweetId, year, month, err.Error())
+		}
+
+		return true, err
+	}
+
+	return true, nil
+}
+
+// reportCounterValues lists the counters of a report that are recounted from raw events, under their stored names.
+func reportCounterValues(report *model.Report) bson.D {
+	return bson.D{
+		{"likesCount", report.LikesCount},
+		{"unlikesCount", report.UnlikesCount},
+		{"profileVisits", report.ProfileVisits},
+		{"impressions", report.Impressions},
+		{"viewCount", report.ViewCount},
+		{"viewTimeSum", report.ViewTimeSum},
+		{"clicks", report.Clicks},
+		{"linkClicks", report.LinkClicks},
+		{"mediaClicks", report.MediaClicks},
+		{"hashtagClicks", report.HashtagClicks},
+		{"conversions", report.Conversions},
+		{"retweets", report.Retweets},
+		{"replies", report.Replies},
+		{"follows", report.Follows},
+		{"lateEvents", report.LateEvents},
+		{"inactiveEvents", report.InactiveEvents},
+		{"attributedConversions", report.AttributedConversions},
+		{"organicConversions", report.OrganicConversions},
+	}
+}
@@ -3,17 +3,29 @@ package repository
 import (
 	"context"
 	"github.com/FTN-TwitterClone/ads/model"
+	"time"
 )
 
 type ReportsRepository interface {
 	GetMonthlyReport(ctx context.Context, tweetId string, year int64, month int64) (*model.Report, error)
 	GetDailyReport(ctx context.Context, tweetId string, year int64, month int64, day int64) (*model.Report, error)
-	UpsertMonthlyReportLikesCount(ctx context.Context, tweetId string, year int64, month int64) error
-	UpsertMonthlyReportUnlikesCount(ctx context.Context, tweetId string, year int64, month int64) error
-	UpsertMonthlyReportProfileVisitsCount(ctx context.Context, tweetId string, year int64, month int64) error
-	UpsertMonthlyReportAverageProfileViewTime(ctx context.Context, tweetId string, year int64, month int64, averageViewTime int64) error
-	UpsertDailyReportLikesCount(ctx context.Context, tweetId string, year int64, month int64, day int64) error
-	UpsertDailyReportUnlikesCount(ctx context.Context, tweetId string, year int64, month int64, day int64) error
-	UpsertDailyReportProfileVisitsCount(ctx context.Context, tweetId string, year int64, month int64, day int64) error
-	UpsertDailyReportAverageProfileViewTime(ctx context.Context, tweetId string, year int64, month int64, day int64, averageViewTime int64) error
+	GetHourlyReport(ctx context.Context, tweetId string, year int64, month int64, day int64, hour int64) (*model.Report, error)
+	GetRangeReport(ctx context.Context, tweetId string, from time.Time, to time.Time) (*model.Report, error)
+	GetCampaignMonthlyReport(ctx context.Context, tweetIds []string, year int64, month int64) (*model.CampaignReport, error)
+	GetCampaignDailyReport(ctx context.Context, tweetIds []string, year int64, month int64, day int64) (*model.CampaignReport, error)
+	GetLifetimeReports(ctx context.Context, tweetIds []string) ([]model.Report, error)
+	GetAudienceBreakdown(ctx context.Context, tweetId string, from time.Time, to time.Time) (*model.AudienceBreakdown, error)
+	GetDeliveredHours(ctx context.Context, tweetId string, from time.Time, to time.Time) (*int, error)
+	GetReportSeries(ctx context.Context, tweetId string, from time.Time, to time.Time, granularity string) ([]model.Report, error)
+	ApplyReportEvents(ctx context.Context, events []model.ReportEvent) error
+	SaveDeadLetters(ctx context.Context, letters []model.DeadLetter) error
+	GetDeadLetters(ctx context.Context) ([]model.DeadLetter, error)
+	ClaimDeadLetter(ctx context.Context, letter *model.DeadLetter, until time.Time) (bool, error)
+	DeleteDeadLetter(ctx context.Context, letter *model.DeadLetter) error
+	DeleteMonthReports(ctx context.Context, tweetId string, year int64, month int64) error
+	ArchiveReports(ctx context.Context, ad *model.ArchivedAd) error
+	RepairReportCounters(ctx context.Context, tweetId string, year int64, month int64, day int64, reported *model.Report, counted *model.Report) (bool, error)
+	GetReportKeysWithoutViewTimeTotals(ctx context.Context) ([]model.ReportKey, error)
+	BackfillReportViewTimeTotals(ctx context.Context, key model.ReportKey, viewTimeSum int64, viewCount int) error
+	SaveMigrationCutoff(ctx context.Context, name string, cutoff time.Time) (time.Time, error)
 }
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"sort"
+	"strconv"
+)
+
+const (
+	sortAdsByCreated   = "created"
+	defaultAdsPageSize = 20
+	maxAdsPageSize     = 100
+	// ads of an advertiser are read this many at a time when they're sorted by performance
+	adsScanPageSize = 1000
+)
+
+// adSortKeys are the lifetime figures ads can be sorted by besides creation time, highest first.
+var adSortKeys = map[string]func(r *model.Report) float64{
+	"impressions":      func(r *model.Report) float64 { return float64(r.Impressions) },
+	"likes":            func(r *model.Report) float64 { return float64(r.LikesCount) },
+	"profileVisits":    func(r *model.Report) float64 { return float64(r.ProfileVisits) },
+	"clicks":           func(r *model.Report) float64 { return float64(r.Clicks) },
+	"conversions":      func(r *model.Report) float64 { return float64(r.Conversions) },
+	"engagementRate":   func(r *model.Report) float64 { return r.EngagementRate },
+	"clickThroughRate": func(r *model.Report) float64 { return r.ClickThroughRate },
+	"conversionRate":   func(r *model.Report) float64 { return r.ConversionRate },
+}
+
+var (
+	ErrUnknownAdsSort     = errors.New("unknown sort")
+	ErrInvalidAdsPageSize = errors.New("limit must be between 1 and 100")
+	ErrInvalidAdsCursor   = errors.New("invalid cursor")
+)
+
+// adsQuery is a validated request for a page of an advertiser's ads. Pages sorted by creation time are read straight
+// from ads_by_owner and pageState is Cassandra's, pages sorted by performance are cut from every ad sorted in memory.
+type adsQuery struct {
+	sort      string
+	limit     int
+	pageState []byte
+	offset    int
+}
+
+func parseAdsQuery(sortBy string, limit int, cursor string) (*adsQuery, error) {
+	q := &adsQuery{sort: sortBy, limit: limit}
+
+	if q.sort == "" {
+		q.sort = sortAdsByCreated
+	}
+	if _, ok := adSortKeys[q.sort]; !ok && q.sort != sortAdsByCreated {
+		return nil, ErrUnknownAdsSort
+	}
+
+	if q.limit == 0 {
+		q.limit = defaultAdsPageSize
+	}
+	if q.limit < 0 || q.limit > maxAdsPageSize {
+		return nil, ErrInvalidAdsPageSize
+	}
+
+	if cursor == "" {
+		return q, nil
+	}
+
+	if q.sort == sortAdsByCreated {
+		pageState, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, ErrInvalidAdsCursor
+		}
+		q.pageState = pageState
+	} else {
+		offset, err := strconv.Atoi(cursor)
+		if err != nil || offset < 0 {
+			return nil, ErrInvalidAdsCursor
+		}
+		q.offset = offset
+	}
+
+	return q, nil
+}
+
+// listAds reads a page of the ads posted by owner with their lifetime figures.
+func listAds(ctx context.Context, eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, owner string, q *adsQuery) (*model.AdPage, error) {
+	if q.sort == sortAdsByCreated {
+		tweetIds, pageState, err := eventsRepository.GetAdsByOwner(ctx, owner, q.limit, q.pageState)
+		if err != nil {
+			return nil, err
+		}
+
+		lifetime, err := lifetimeReports(ctx, reportsRepository, tweetIds)
+		if err != nil {
+			return nil, err
+		}
+
+		page := &model.AdPage{}
+		if pageState != nil {
+			page.Next = base64.RawURLEncoding.EncodeToString(pageState)
+		}
+
+		page.Ads, err = adOverviews(ctx, eventsRepository, tweetIds, lifetime)
+		if err != nil {
+			return nil, err
+		}
+
+		return page, nil
+	}
+
+	var tweetIds []string
+	var pageState []byte
+	for {
+		ids, next, err := eventsRepository.GetAdsByOwner(ctx, owner, adsScanPageSize, pageState)
+		if err != nil {
+			return nil, err
+		}
+
+		tweetIds = append(tweetIds, ids...)
+		if next == nil {
+			break
+		}
+		pageState = next
+	}
+
+	lifetime, err := lifetimeReports(ctx, reportsRepository, tweetIds)
+	if err != nil {
+		return nil, err
+	}
+
+	// ties stay newest first, the order ads_by_owner keeps them in
+	key := adSortKeys[q.sort]
+	sort.SliceStable(tweetIds, func(i, j int) bool {
+		a, b := lifetime[tweetIds[i]], lifetime[tweetIds[j]]
+		return key(&a) > key(&b)
+	})
+
+	page := &model.AdPage{}
+
+	from := q.offset
+	if from > len(tweetIds) {
+		from = len(tweetIds)
+	}
+	to := from + q.limit
+	if to < len(tweetIds) {
+		page.Next = strconv.Itoa(to)
+	} else {
+		to = len(tweetIds)
+	}
+
+	page.Ads, err = adOverviews(ctx, eventsRepository, tweetIds[from:to], lifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func lifetimeReports(ctx context.Context, reportsRepository repository.ReportsRepository, tweetIds []string) (map[string]model.Report, error) {
+	lifetime := map[string]model.Report{}
+
+	if len(tweetIds) == 0 {
+		return lifetime, nil
+	}
+
+	reports, err := reportsRepository.GetLifetimeReports(ctx, tweetIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range reports {
+		lifetime[r.TweetId] = r
+	}
+
+	return lifetime, nil
+}
+
+func adOverviews(ctx context.Context, eventsRepository repository.EventsRepository, tweetIds []string, lifetime map[string]model.Report) ([]model.AdOverview, error) {
+	overviews := make([]model.AdOverview, 0, len(tweetIds))
+
+	for _, tweetId := range tweetIds {
+		adInfo, err := eventsRepository.GetAdInfo(ctx, tweetId)
+		if err == gocql.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		report, ok := lifetime[tweetId]
+		if !ok {
+			report = model.Report{TweetId: tweetId}
+		}
+
+		overviews = append(overviews, model.AdOverview{
+			AdInfo:    *adInfo,
+			CreatedAt: adInfo.TweetId.Time(),
+			Lifetime:  report,
+		})
+	}
+
+	return overviews, nil
+}
+
+// BackfillAdsByOwner lists the ads saved before ads_by_owner existed under their advertiser, it's safe to run again.
+func BackfillAdsByOwner(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository) error {
+	serviceCtx, span := tracer.Start(ctx, "BackfillAdsByOwner")
+	defer span.End()
+
+	count, err := eventsRepository.BackfillAdsByOwner(serviceCtx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	log.Printf("indexed %d ads by owner", count)
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/app_errors"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"strings"
+	"time"
+)
+
+var scheduleDays = map[string]time.Weekday{
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+	"sunday":    time.Sunday,
+}
+
+// validateSchedule checks a schedule set by an advertiser and lowercases its days the way they're matched.
+func validateSchedule(schedule *model.AdSchedule) *app_errors.AppError {
+	var start time.Time
+	if schedule.StartDate != "" {
+		var err error
+		start, err = time.Parse("2006-01-02", schedule.StartDate)
+		if err != nil {
+			return &app_errors.AppError{422, "Invalid start date"}
+		}
+	}
+
+	if schedule.EndDate != "" {
+		end, err := time.Parse("2006-01-02", schedule.EndDate)
+		if err != nil {
+			return &app_errors.AppError{422, "Invalid end date"}
+		}
+
+		if end.Before(start) {
+			return &app_errors.AppError{422, "End date is before start date"}
+		}
+	}
+
+	for i := range schedule.DayParts {
+		part := &schedule.DayParts[i]
+
+		if part.FromHour < 0 || part.ToHour > 24 || part.FromHour >= part.ToHour {
+			return &app_errors.AppError{422, "Day parts must run from an hour of the day up to a later one, 24 at the latest"}
+		}
+
+		for j, day := range part.Days {
+			part.Days[j] = strings.ToLower(day)
+			if _, ok := scheduleDays[part.Days[j]]; !ok {
+				return &app_errors.AppError{422, fmt.Sprintf("Unknown day %s", day)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// onSchedule reports whether a schedule runs its ad at t, given in the ad's timezone.
+func onSchedule(schedule model.AdSchedule, t time.Time) bool {
+	// dates in the same format compare as strings
+	date := t.Format("2006-01-02")
+	if schedule.StartDate != "" && date < schedule.StartDate {
+		return false
+	}
+	if schedule.EndDate != "" && date > schedule.EndDate {
+		return false
+	}
+
+	if len(schedule.DayParts) == 0 {
+		return true
+	}
+
+	for _, part := range schedule.DayParts {
+		if t.Hour() < part.FromHour || t.Hour() >= part.ToHour {
+			continue
+		}
+
+		if len(part.Days) == 0 {
+			return true
+		}
+
+		for _, day := range part.Days {
+			if scheduleDays[day] == t.Weekday() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// scheduleAt returns the schedule an ad had at t. Ads without a history have always had their current schedule, and
+// times before the first version get the first one.
+func scheduleAt(adInfo *model.AdInfo, history []model.AdScheduleVersion, t time.Time) model.AdSchedule {
+	if len(history) == 0 {
+		return adInfo.Schedule
+	}
+
+	schedule := history[0].AdSchedule
+	for _, version := range history {
+		if version.ValidFrom.After(t) {
+			break
+		}
+		schedule = version.AdSchedule
+	}
+
+	return schedule
+}
+
+// changeAdSchedule adds a schedule version to an ad. The schedule of an ad saved before versions were kept becomes its
+// first version, valid since the tweet was posted.
+func changeAdSchedule(ctx context.Context, eventsRepository repository.EventsRepository, adInfo *model.AdInfo, version *model.AdScheduleVersion) error {
+	tweetId := adInfo.TweetId.String()
+
+	history, err := eventsRepository.GetAdScheduleHistory(ctx, tweetId)
+	if err != nil {
+		return err
+	}
+
+	if len(history) == 0 {
+		err = eventsRepository.UpdateAdSchedule(ctx, tweetId, &model.AdScheduleVersion{
+			AdSchedule: adInfo.Schedule,
+			ValidFrom:  adInfo.TweetId.Time(),
+			ChangedBy:  adInfo.PostedBy,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return eventsRepository.UpdateAdSchedule(ctx, tweetId, version)
+}
+
+// adActivityAt returns the status an ad had at t and whether the schedule it had then ran it. An ad is shown at t when
+// it was posted by then, was active and was on schedule.
+func adActivityAt(ctx context.Context, eventsRepository repository.EventsRepository, adInfo *model.AdInfo, t time.Time) (active bool, status string, scheduled bool, err error) {
+	status, err = adStatusAt(ctx, eventsRepository, adInfo, t)
+	if err != nil {
+		return false, "", false, err
+	}
+
+	history, err := eventsRepository.GetAdScheduleHistory(ctx, adInfo.TweetId.String())
+	if err != nil {
+		return false, "", false, err
+	}
+
+	scheduled = onSchedule(scheduleAt(adInfo, history, t), t.In(adLocation(adInfo)))
+	active = !t.Before(adInfo.TweetId.Time()) && status == model.AD_ACTIVE && scheduled
+
+	return active, status, scheduled, nil
+}
+
+// scheduledHours counts the hours from the day of from up to and including the day of to in loc the ad was active in
+// for at least part of the hour and the schedule it had at the start of the hour ran it.
+func scheduledHours(adInfo *model.AdInfo, history []model.AdStatusChange, scheduleHistory []model.AdScheduleVersion, from time.Time, to time.Time, loc *time.Location) int {
+	periods := activePeriods(adInfo, history, time.Now())
+	end := inLocation(to, loc).AddDate(0, 0, 1)
+
+	hours := 0
+	for hour := inLocation(from, loc); hour.Before(end); hour = hour.Add(time.Hour) {
+		if onSchedule(scheduleAt(adInfo, scheduleHistory, hour), hour) && activeBetween(periods, hour, hour.Add(time.Hour)) {
+			hours++
+		}
+	}
+
+	return hours
+}
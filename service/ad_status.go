@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"os"
+	"time"
+)
+
+// countInactiveEvents keeps events of ads that aren't active and counts them apart instead of rejecting them.
+var countInactiveEvents = os.Getenv("AD_INACTIVE_EVENT_POLICY") == "count"
+
+var ErrAdNotActive = errors.New("ad isn't active")
+
+// adStatusTransitions are the statuses an ad can move to from each status, ended ads stay ended.
+var adStatusTransitions = map[string][]string{
+	model.AD_DRAFT:  {model.AD_ACTIVE, model.AD_ENDED},
+	model.AD_ACTIVE: {model.AD_PAUSED, model.AD_ENDED},
+	model.AD_PAUSED: {model.AD_ACTIVE, model.AD_ENDED},
+	model.AD_ENDED:  {},
+}
+
+func isAdStatus(status string) bool {
+	_, ok := adStatusTransitions[status]
+	return ok
+}
+
+func canChangeAdStatus(from string, to string) bool {
+	for _, status := range adStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// statusAt returns the status an ad had at t given its history, ads were active before their first recorded change.
+func statusAt(history []model.AdStatusChange, t time.Time) string {
+	status := model.AD_ACTIVE
+	for _, change := range history {
+		if change.ChangedAt.After(t) {
+			break
+		}
+		status = change.Status
+	}
+	return status
+}
+
+// adStatusAt returns the status an ad had at t, the history is only read for times before the last change.
+func adStatusAt(ctx context.Context, eventsRepository repository.EventsRepository, adInfo *model.AdInfo, t time.Time) (string, error) {
+	if !t.Before(adInfo.StatusChangedAt) {
+		return adInfo.Status, nil
+	}
+
+	history, err := eventsRepository.GetAdStatusHistory(ctx, adInfo.TweetId.String())
+	if err != nil {
+		return "", err
+	}
+
+	return statusAt(history, t), nil
+}
+
+// checkAdActive returns ErrAdNotActive for events that happened while their ad wasn't active, or reports them as
+// inactive when they're counted apart. Events of tweets that aren't ads are always counted.
+func checkAdActive(ctx context.Context, eventsRepository repository.EventsRepository, adInfo *model.AdInfo, occurredAt time.Time) (inactive bool, err error) {
+	if adInfo == nil {
+		return false, nil
+	}
+
+	status, err := adStatusAt(ctx, eventsRepository, adInfo, occurredAt)
+	if err != nil {
+		return false, err
+	}
+
+	if status == model.AD_ACTIVE {
+		return false, nil
+	}
+
+	if !countInactiveEvents {
+		return false, ErrAdNotActive
+	}
+
+	return true, nil
+}
+
+// markInactiveEvents flags the stored events that happened while their ad wasn't active, the way ingestion did.
+func markInactiveEvents(events []model.ReportEvent, history []model.AdStatusChange) {
+	for i := range events {
+		events[i].Inactive = statusAt(history, events[i].Time) != model.AD_ACTIVE
+	}
+}
+
+// adPeriod is a span of time [start, end) an ad was active in.
+type adPeriod struct {
+	start time.Time
+	end   time.Time
+}
+
+// activePeriods lists the periods an ad was active in from when it was created, the last one ends at now.
+func activePeriods(adInfo *model.AdInfo, history []model.AdStatusChange, now time.Time) []adPeriod {
+	created := adInfo.TweetId.Time()
+
+	// periods of the same status, starting at creation
+	starts := []time.Time{created}
+	for _, change := range history {
+		if change.ChangedAt.After(created) {
+			starts = append(starts, change.ChangedAt)
+		}
+	}
+
+	var periods []adPeriod
+	for i, start := range starts {
+		end := now
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		if end.After(start) && statusAt(history, start) == model.AD_ACTIVE {
+			periods = append(periods, adPeriod{start, end})
+		}
+	}
+
+	return periods
+}
+
+// activeBetween reports whether any of periods overlaps [from, to).
+func activeBetween(periods []adPeriod, from time.Time, to time.Time) bool {
+	for _, p := range periods {
+		if p.start.Before(to) && p.end.After(from) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeDays counts the days from the day of from up to and including the day of to in loc the ad was active on for
+// at least part of the day. Days before the ad was created and after now aren't counted.
+func activeDays(adInfo *model.AdInfo, history []model.AdStatusChange, from time.Time, to time.Time, loc *time.Location) int {
+	periods := activePeriods(adInfo, history, time.Now())
+	last := inLocation(to, loc)
+
+	days := 0
+	for day := inLocation(from, loc); !day.After(last); day = day.AddDate(0, 0, 1) {
+		if activeBetween(periods, day, day.AddDate(0, 0, 1)) {
+			days++
+		}
+	}
+
+	return days
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/app_errors"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"strings"
+	"time"
+)
+
+// ads can only target viewers old enough to be on the platform
+const (
+	minTargetAge = 13
+	maxTargetAge = 120
+)
+
+// validateTargeting checks targeting set by an advertiser and lowercases its gender the way it's matched.
+func validateTargeting(targeting *model.AdTargeting) *app_errors.AppError {
+	if targeting.MinAge != 0 && (targeting.MinAge < minTargetAge || targeting.MinAge > maxTargetAge) {
+		return &app_errors.AppError{422, fmt.Sprintf("Minimum age must be between %d and %d", minTargetAge, maxTargetAge)}
+	}
+
+	if targeting.MaxAge != 0 && (targeting.MaxAge < minTargetAge || targeting.MaxAge > maxTargetAge) {
+		return &app_errors.AppError{422, fmt.Sprintf("Maximum age must be between %d and %d", minTargetAge, maxTargetAge)}
+	}
+
+	if targeting.MinAge != 0 && targeting.MaxAge != 0 && targeting.MinAge > targeting.MaxAge {
+		return &app_errors.AppError{422, "Minimum age is above maximum age"}
+	}
+
+	targeting.Gender = strings.ToLower(targeting.Gender)
+	switch targeting.Gender {
+	case "", model.MALE_GENDER, model.FEMALE_GENDER:
+	default:
+		return &app_errors.AppError{422, "Unknown gender"}
+	}
+
+	targeting.Town = strings.TrimSpace(targeting.Town)
+
+	return nil
+}
+
+func adTargeting(adInfo *model.AdInfo) model.AdTargeting {
+	return model.AdTargeting{
+		Town:   adInfo.Town,
+		MinAge: adInfo.MinAge,
+		MaxAge: adInfo.MaxAge,
+		Gender: adInfo.Gender,
+	}
+}
+
+// targetingAt returns the ad with the targeting it had at t. Ads without a history have always had their current
+// targeting, and times before the first version get the first one.
+func targetingAt(adInfo *model.AdInfo, history []model.AdTargetingVersion, t time.Time) *model.AdInfo {
+	if adInfo == nil || len(history) == 0 {
+		return adInfo
+	}
+
+	targeting := history[0].AdTargeting
+	for _, version := range history {
+		if version.ValidFrom.After(t) {
+			break
+		}
+		targeting = version.AdTargeting
+	}
+
+	at := *adInfo
+	at.Town = targeting.Town
+	at.MinAge = targeting.MinAge
+	at.MaxAge = targeting.MaxAge
+	at.Gender = targeting.Gender
+
+	return &at
+}
+
+// changeAdTargeting adds a targeting version to an ad. The targeting of an ad saved before versions were kept becomes
+// its first version, valid since the tweet was posted.
+func changeAdTargeting(ctx context.Context, eventsRepository repository.EventsRepository, adInfo *model.AdInfo, version *model.AdTargetingVersion) error {
+	tweetId := adInfo.TweetId.String()
+
+	history, err := eventsRepository.GetAdTargetingHistory(ctx, tweetId)
+	if err != nil {
+		return err
+	}
+
+	if len(history) == 0 {
+		err = eventsRepository.UpdateAdTargeting(ctx, tweetId, &model.AdTargetingVersion{
+			AdTargeting: adTargeting(adInfo),
+			ValidFrom:   adInfo.TweetId.Time(),
+			ChangedBy:   adInfo.PostedBy,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return eventsRepository.UpdateAdTargeting(ctx, tweetId, version)
+}
@@ -15,13 +15,15 @@ import (
 type AdsService struct {
 	eventsRepository  repository.EventsRepository
 	reportsRepository repository.ReportsRepository
+	aggregator        *ReportAggregator
 	tracer            trace.Tracer
 }
 
-func NewAdsService(adsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, tracer trace.Tracer) *AdsService {
+func NewAdsService(adsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, aggregator *ReportAggregator, tracer trace.Tracer) *AdsService {
 	return &AdsService{
 		adsRepository,
 		reportsRepository,
+		aggregator,
 		tracer,
 	}
 }
@@ -46,11 +48,68 @@ func (s *AdsService) GetAdInfo(ctx context.Context, tweetId string) (*model.AdIn
 	return adInfo, nil
 }
 
-func (s *AdsService) AddProfileVisitedEvent(ctx context.Context, tweetId string) *app_errors.AppError {
+// GetAds lists the caller's ads a page at a time, sorted by creation time or by a lifetime figure.
+func (s *AdsService) GetAds(ctx context.Context, sortBy string, limit int, cursor string) (*model.AdPage, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.GetAds")
+	defer span.End()
+
+	q, err := parseAdsQuery(sortBy, limit, cursor)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{422, err.Error()}
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	page, err := listAds(serviceCtx, s.eventsRepository, s.reportsRepository, authUser.Username, q)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	return page, nil
+}
+
+func (s *AdsService) AddProfileVisitedEvent(ctx context.Context, tweetId string, occurrence model.EventTime, eventKey string) *app_errors.AppError {
 	serviceCtx, span := s.tracer.Start(ctx, "AdsService.AddProfileVisitedEvent")
 	defer span.End()
 
-	uuid, err := gocql.ParseUUID(tweetId)
+	return s.addEvent(serviceCtx, span, model.ReportEvent{
+		Kind:    model.VISIT_EVENT,
+		TweetId: tweetId,
+	}, occurrence.OccurredAt, eventKey)
+}
+
+func (s *AdsService) AddTweetViewedEvent(ctx context.Context, tweetId string, viewTime model.TweetViewTime, eventKey string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.AddTweetViewedEvent")
+	defer span.End()
+
+	return s.addEvent(serviceCtx, span, model.ReportEvent{
+		Kind:     model.VIEW_EVENT,
+		TweetId:  tweetId,
+		ViewTime: int64(viewTime.ViewTime),
+	}, viewTime.OccurredAt, eventKey)
+}
+
+func (s *AdsService) AddTweetClickedEvent(ctx context.Context, tweetId string, click model.TweetClick, eventKey string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.AddTweetClickedEvent")
+	defer span.End()
+
+	if !isClickType(click.ClickType) {
+		span.SetStatus(codes.Error, fmt.Sprintf("Unknown click type %s", click.ClickType))
+		return &app_errors.AppError{422, "Unknown click type"}
+	}
+
+	return s.addEvent(serviceCtx, span, model.ReportEvent{
+		Kind:      model.CLICK_EVENT,
+		TweetId:   tweetId,
+		ClickType: click.ClickType,
+	}, click.OccurredAt, eventKey)
+}
+
+// addEvent ingests one event of the caller, e has its kind, tweet and the fields of that kind set.
+func (s *AdsService) addEvent(ctx context.Context, span trace.Span, e model.ReportEvent, occurredAt time.Time, eventKey string) *app_errors.AppError {
+	uuid, err := gocql.ParseUUID(e.TweetId)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return &app_errors.AppError{422, "Invalid UUID"}
@@ -58,27 +117,81 @@ func (s *AdsService) AddProfileVisitedEvent(ctx context.Context, tweetId string)
 
 	authUser := ctx.Value("authUser").(model.AuthUser)
 
-	now := time.Now()
+	if len(eventKey) > maxEventKeyLength {
+		span.SetStatus(codes.Error, "Event key too long")
+		return &app_errors.AppError{422, "Idempotency key too long"}
+	}
+
+	e.Username = authUser.Username
+
+	item := ingestEvent(ctx, s.eventsRepository, s.aggregator, uuid, e, eventKey, occurredAt, func(username string) (model.Demographics, error) {
+		return resolveDemographics(ctx, s.eventsRepository, username, authUser.Demographics)
+	})
+	if item.result.Status != 200 {
+		span.SetStatus(codes.Error, item.cause.Error())
+		return &app_errors.AppError{item.result.Status, item.result.Error}
+	}
+
+	return nil
+}
+
+func (s *AdsService) SetAdTimezone(ctx context.Context, tweetId string, timezone model.AdTimezone) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.SetAdTimezone")
+	defer span.End()
 
-	e := model.ProfileVisitedEvent{
-		Username: authUser.Username,
-		TweetId:  uuid,
-		Time:     now,
+	_, err := time.LoadLocation(timezone.Timezone)
+	if err != nil || timezone.Timezone == "" {
+		span.SetStatus(codes.Error, fmt.Sprintf("Unknown timezone %s", timezone.Timezone))
+		return &app_errors.AppError{422, "Unknown timezone"}
 	}
 
-	err = s.eventsRepository.SaveProfileVisitedEvent(serviceCtx, &e)
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	adInfo, err := s.eventsRepository.GetAdInfo(serviceCtx, tweetId)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return &app_errors.AppError{500, ""}
 	}
 
-	err = s.reportsRepository.UpsertMonthlyReportProfileVisitsCount(serviceCtx, tweetId, int64(now.Year()), int64(now.Month()))
+	if adInfo.PostedBy != authUser.Username {
+		span.SetStatus(codes.Error, fmt.Sprintf("User %s doesn't have access!", authUser.Username))
+		return &app_errors.AppError{403, ""}
+	}
+
+	err = s.eventsRepository.UpdateAdTimezone(serviceCtx, tweetId, timezone.Timezone)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return &app_errors.AppError{500, ""}
 	}
 
-	err = s.reportsRepository.UpsertDailyReportProfileVisitsCount(serviceCtx, tweetId, int64(now.Year()), int64(now.Month()), int64(now.Day()))
+	return nil
+}
+
+// SetAdSchedule sets when an ad of the caller runs, an empty schedule runs it whenever it's active. The schedule it had
+// before stays in its history.
+func (s *AdsService) SetAdSchedule(ctx context.Context, tweetId string, schedule model.AdSchedule) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.SetAdSchedule")
+	defer span.End()
+
+	appErr := validateSchedule(&schedule)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	adInfo, appErr := s.GetAdInfo(serviceCtx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	err := changeAdSchedule(serviceCtx, s.eventsRepository, adInfo, &model.AdScheduleVersion{
+		AdSchedule: schedule,
+		ValidFrom:  time.Now(),
+		ChangedBy:  authUser.Username,
+	})
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return &app_errors.AppError{500, ""}
@@ -87,57 +200,226 @@ func (s *AdsService) AddProfileVisitedEvent(ctx context.Context, tweetId string)
 	return nil
 }
 
-func (s *AdsService) AddTweetViewedEvent(ctx context.Context, tweetId string, viewTime model.TweetViewTime) *app_errors.AppError {
-	serviceCtx, span := s.tracer.Start(ctx, "AdsService.AddTweetViewedEvent")
+// SetAdStatus moves an ad of the caller through its lifecycle, setting the status it already has does nothing.
+func (s *AdsService) SetAdStatus(ctx context.Context, tweetId string, status model.AdStatus) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.SetAdStatus")
 	defer span.End()
 
-	uuid, err := gocql.ParseUUID(tweetId)
+	if !isAdStatus(status.Status) {
+		span.SetStatus(codes.Error, fmt.Sprintf("Unknown status %s", status.Status))
+		return &app_errors.AppError{422, "Unknown status"}
+	}
+
+	adInfo, appErr := s.GetAdInfo(serviceCtx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	if adInfo.Status == status.Status {
+		return nil
+	}
+
+	if !canChangeAdStatus(adInfo.Status, status.Status) {
+		message := fmt.Sprintf("Can't change status from %s to %s", adInfo.Status, status.Status)
+		span.SetStatus(codes.Error, message)
+		return &app_errors.AppError{409, message}
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	err := s.eventsRepository.UpdateAdStatus(serviceCtx, tweetId, &model.AdStatusChange{
+		Status:    status.Status,
+		ChangedAt: time.Now(),
+		ChangedBy: authUser.Username,
+	})
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return &app_errors.AppError{422, "Invalid UUID"}
+		return &app_errors.AppError{500, ""}
 	}
 
-	authUser := ctx.Value("authUser").(model.AuthUser)
+	return nil
+}
 
-	now := time.Now()
-	loc := now.Location()
+func (s *AdsService) GetAdStatusHistory(ctx context.Context, tweetId string) ([]model.AdStatusChange, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.GetAdStatusHistory")
+	defer span.End()
 
-	e := model.TweetViewedEvent{
-		Username: authUser.Username,
-		TweetId:  uuid,
-		ViewTime: viewTime.ViewTime,
-		Time:     now,
+	_, appErr := s.GetAdInfo(serviceCtx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
 	}
 
-	err = s.eventsRepository.SaveTweetViewedEvent(serviceCtx, &e)
+	history, err := s.eventsRepository.GetAdStatusHistory(serviceCtx, tweetId)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return &app_errors.AppError{500, ""}
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	return history, nil
+}
+
+// SetAdTargeting changes who an ad of the caller is shown to, the targeting it had before stays in its history.
+func (s *AdsService) SetAdTargeting(ctx context.Context, tweetId string, targeting model.AdTargeting) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.SetAdTargeting")
+	defer span.End()
+
+	appErr := validateTargeting(&targeting)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	adInfo, appErr := s.GetAdInfo(serviceCtx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
 	}
 
-	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	if adTargeting(adInfo) == targeting {
+		return nil
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
 
-	monthAvg, err := s.eventsRepository.GetAverageTweetViewTime(serviceCtx, uuid, monthStart, now)
+	err := changeAdTargeting(serviceCtx, s.eventsRepository, adInfo, &model.AdTargetingVersion{
+		AdTargeting: targeting,
+		ValidFrom:   time.Now(),
+		ChangedBy:   authUser.Username,
+	})
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return &app_errors.AppError{500, ""}
 	}
 
-	err = s.reportsRepository.UpsertMonthlyReportAverageProfileViewTime(serviceCtx, tweetId, int64(now.Year()), int64(now.Month()), int64(monthAvg))
+	return nil
+}
+
+func (s *AdsService) GetAdTargetingHistory(ctx context.Context, tweetId string) ([]model.AdTargetingVersion, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.GetAdTargetingHistory")
+	defer span.End()
+
+	adInfo, appErr := s.GetAdInfo(serviceCtx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	history, appErr := s.adTargetingHistory(serviceCtx, adInfo)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	return history, nil
+}
+
+// adTargetingHistory lists the targeting versions of an ad, an ad that was never retargeted has had its current one
+// since it was posted.
+func (s *AdsService) adTargetingHistory(ctx context.Context, adInfo *model.AdInfo) ([]model.AdTargetingVersion, *app_errors.AppError) {
+	history, err := s.eventsRepository.GetAdTargetingHistory(ctx, adInfo.TweetId.String())
+	if err != nil {
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	if len(history) == 0 {
+		history = append(history, model.AdTargetingVersion{
+			AdTargeting: adTargeting(adInfo),
+			ValidFrom:   adInfo.TweetId.Time(),
+			ChangedBy:   adInfo.PostedBy,
+		})
+	}
+
+	return history, nil
+}
+
+func (s *AdsService) GetAdScheduleHistory(ctx context.Context, tweetId string) ([]model.AdScheduleVersion, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.GetAdScheduleHistory")
+	defer span.End()
+
+	adInfo, appErr := s.GetAdInfo(serviceCtx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	history, appErr := s.adScheduleHistory(serviceCtx, adInfo)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	return history, nil
+}
+
+// adScheduleHistory lists the schedule versions of an ad, an ad that was never rescheduled has had its current one
+// since it was posted.
+func (s *AdsService) adScheduleHistory(ctx context.Context, adInfo *model.AdInfo) ([]model.AdScheduleVersion, *app_errors.AppError) {
+	history, err := s.eventsRepository.GetAdScheduleHistory(ctx, adInfo.TweetId.String())
+	if err != nil {
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	if len(history) == 0 {
+		history = append(history, model.AdScheduleVersion{
+			AdSchedule: adInfo.Schedule,
+			ValidFrom:  adInfo.TweetId.Time(),
+			ChangedBy:  adInfo.PostedBy,
+		})
+	}
+
+	return history, nil
+}
+
+// DeleteAd deletes an ad of the caller and archives its reports with its status, targeting and schedule history. The
+// tweet's events are kept, events still queued for aggregation are counted as events of a tweet that isn't an ad.
+func (s *AdsService) DeleteAd(ctx context.Context, tweetId string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.DeleteAd")
+	defer span.End()
+
+	adInfo, appErr := s.GetAdInfo(serviceCtx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	statusHistory, err := s.eventsRepository.GetAdStatusHistory(serviceCtx, tweetId)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return &app_errors.AppError{500, ""}
 	}
 
-	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	targetingHistory, appErr := s.adTargetingHistory(serviceCtx, adInfo)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	scheduleHistory, appErr := s.adScheduleHistory(serviceCtx, adInfo)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
 
-	dayAvg, err := s.eventsRepository.GetAverageTweetViewTime(serviceCtx, uuid, dayStart, now)
+	// reports are archived first so a failed delete can be retried without losing them
+	err = s.reportsRepository.ArchiveReports(serviceCtx, &model.ArchivedAd{
+		TweetId:          adInfo.TweetId.String(),
+		AdInfo:           *adInfo,
+		StatusHistory:    statusHistory,
+		TargetingHistory: targetingHistory,
+		ScheduleHistory:  scheduleHistory,
+		ArchivedAt:       time.Now(),
+		ArchivedBy:       authUser.Username,
+	})
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return &app_errors.AppError{500, ""}
 	}
 
-	err = s.reportsRepository.UpsertDailyReportAverageProfileViewTime(serviceCtx, tweetId, int64(now.Year()), int64(now.Month()), int64(now.Day()), int64(dayAvg))
+	err = s.eventsRepository.DeleteAdInfo(serviceCtx, adInfo)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return &app_errors.AppError{500, ""}
@@ -170,7 +452,13 @@ func (s *AdsService) GetMonthlyReport(ctx context.Context, tweetId string, year
 	}
 
 	if r == nil {
-		return &model.Report{TweetId: tweetId}, nil
+		r = &model.Report{TweetId: tweetId}
+	}
+
+	err = s.adDelivery(serviceCtx, adInfo, time.Date(int(year), time.Month(month), 1, 0, 0, 0, 0, time.UTC), time.Date(int(year), time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC), r)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
 	}
 
 	return r, nil
@@ -199,9 +487,395 @@ func (s *AdsService) GetDailyReport(ctx context.Context, tweetId string, year in
 		return nil, &app_errors.AppError{500, ""}
 	}
 
+	if r == nil {
+		r = &model.Report{TweetId: tweetId}
+	}
+
+	date := time.Date(int(year), time.Month(month), int(day), 0, 0, 0, 0, time.UTC)
+	err = s.adDelivery(serviceCtx, adInfo, date, date, r)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	return r, nil
+}
+
+func (s *AdsService) GetHourlyReport(ctx context.Context, tweetId string, year int64, month int64, day int64, hour int64) (*model.Report, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.GetHourlyReport")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	adInfo, err := s.eventsRepository.GetAdInfo(serviceCtx, tweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	if adInfo.PostedBy != authUser.Username {
+		span.SetStatus(codes.Error, fmt.Sprintf("User %s doesn't have access!", authUser.Username))
+		return nil, &app_errors.AppError{403, ""}
+	}
+
+	r, err := s.reportsRepository.GetHourlyReport(serviceCtx, tweetId, year, month, day, hour)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
 	if r == nil {
 		return &model.Report{TweetId: tweetId}, nil
 	}
 
 	return r, nil
 }
+
+func (s *AdsService) GetRangeReport(ctx context.Context, tweetId string, from time.Time, to time.Time) (*model.Report, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.GetRangeReport")
+	defer span.End()
+
+	_, err := gocql.ParseUUID(tweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{422, "Invalid UUID"}
+	}
+
+	if to.Before(from) {
+		span.SetStatus(codes.Error, "Invalid date range")
+		return nil, &app_errors.AppError{422, "Invalid date range"}
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	adInfo, err := s.eventsRepository.GetAdInfo(serviceCtx, tweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	if adInfo.PostedBy != authUser.Username {
+		span.SetStatus(codes.Error, fmt.Sprintf("User %s doesn't have access!", authUser.Username))
+		return nil, &app_errors.AppError{403, ""}
+	}
+
+	r, err := s.reportsRepository.GetRangeReport(serviceCtx, tweetId, from, to)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	r.From = from.Format("2006-01-02")
+	r.To = to.Format("2006-01-02")
+
+	err = s.adDelivery(serviceCtx, adInfo, from, to, r)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	return r, nil
+}
+
+const maxSeriesPoints = 1000
+
+func (s *AdsService) GetReportSeries(ctx context.Context, tweetId string, from time.Time, to time.Time, granularity string) (*model.ReportSeries, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.GetReportSeries")
+	defer span.End()
+
+	_, err := gocql.ParseUUID(tweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{422, "Invalid UUID"}
+	}
+
+	if to.Before(from) {
+		span.SetStatus(codes.Error, "Invalid date range")
+		return nil, &app_errors.AppError{422, "Invalid date range"}
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	adInfo, err := s.eventsRepository.GetAdInfo(serviceCtx, tweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	if adInfo.PostedBy != authUser.Username {
+		span.SetStatus(codes.Error, fmt.Sprintf("User %s doesn't have access!", authUser.Username))
+		return nil, &app_errors.AppError{403, ""}
+	}
+
+	// reports are bucketed in the ad's zone, so the bucket boundaries have to be too
+	loc := adLocation(adInfo)
+	from = inLocation(from, loc)
+	to = inLocation(to, loc)
+
+	buckets, ok := seriesBuckets(from, to, granularity)
+	if !ok {
+		span.SetStatus(codes.Error, fmt.Sprintf("Unsupported granularity %s", granularity))
+		return nil, &app_errors.AppError{422, "Unsupported granularity"}
+	}
+
+	if len(buckets) > maxSeriesPoints {
+		span.SetStatus(codes.Error, "Too many points")
+		return nil, &app_errors.AppError{422, fmt.Sprintf("Range is limited to %d points", maxSeriesPoints)}
+	}
+
+	reports, err := s.reportsRepository.GetReportSeries(serviceCtx, tweetId, from, to, granularity)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	found := make(map[string]model.Report, len(reports))
+	for _, r := range reports {
+		found[fmt.Sprintf("%d-%d-%d-%d", r.Year, r.Month, r.Day, r.Hour)] = r
+	}
+
+	points := make([]model.Report, 0, len(buckets))
+	for _, start := range buckets {
+		key := fmt.Sprintf("%d-%d-%d-%d", start.Year(), start.Month(), start.Day(), start.Hour())
+
+		p, ok := found[key]
+		if !ok {
+			p = model.Report{TweetId: tweetId, Year: int64(start.Year()), Month: int64(start.Month()), Day: int64(start.Day()), Hour: int64(start.Hour())}
+			points = append(points, p)
+			continue
+		}
+
+		points = append(points, p)
+	}
+
+	return &model.ReportSeries{
+		TweetId:     tweetId,
+		Granularity: granularity,
+		From:        from.Format("2006-01-02"),
+		To:          to.Format("2006-01-02"),
+		Points:      points,
+	}, nil
+}
+
+// seriesBuckets returns the start of every bucket overlapping [from, to], the first one truncated to its bucket start.
+func seriesBuckets(from time.Time, to time.Time, granularity string) ([]time.Time, bool) {
+	loc := from.Location()
+
+	var start time.Time
+	switch granularity {
+	case model.HOUR, model.DAY:
+		start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	case model.WEEK:
+		// ISO weeks start on Monday
+		offset := (int(from.Weekday()) + 6) % 7
+		start = time.Date(from.Year(), from.Month(), from.Day()-offset, 0, 0, 0, 0, loc)
+	case model.MONTH:
+		start = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return nil, false
+	}
+
+	end := time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, loc)
+
+	var buckets []time.Time
+	for b := start; b.Before(end) && len(buckets) <= maxSeriesPoints; b = nextBucket(b, granularity) {
+		buckets = append(buckets, b)
+	}
+
+	return buckets, true
+}
+
+func nextBucket(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case model.HOUR:
+		return start.Add(time.Hour)
+	case model.WEEK:
+		return start.AddDate(0, 0, 7)
+	case model.MONTH:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+func (s *AdsService) GetAdSummary(ctx context.Context, tweetId string, from time.Time, to time.Time) (*model.AdSummary, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.GetAdSummary")
+	defer span.End()
+
+	adInfo, appErr := s.GetAdInfo(serviceCtx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	total, appErr := s.GetRangeReport(serviceCtx, tweetId, from, to)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	monthly, appErr := s.GetReportSeries(serviceCtx, tweetId, from, to, model.MONTH)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	daily, appErr := s.GetReportSeries(serviceCtx, tweetId, from, to, model.DAY)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	history, err := s.eventsRepository.GetAdStatusHistory(serviceCtx, tweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	targetingHistory, appErr := s.adTargetingHistory(serviceCtx, adInfo)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	scheduleHistory, appErr := s.adScheduleHistory(serviceCtx, adInfo)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	return &model.AdSummary{
+		AdInfo:           *adInfo,
+		From:             total.From,
+		To:               total.To,
+		Total:            *total,
+		Monthly:          monthly.Points,
+		Daily:            daily.Points,
+		StatusHistory:    history,
+		TargetingHistory: targetingHistory,
+		ScheduleHistory:  scheduleHistory,
+	}, nil
+}
+
+// adDelivery sets how many days and hours of the period from the day of from up to and including the day of to the
+// ad ran in on its report.
+func (s *AdsService) adDelivery(ctx context.Context, adInfo *model.AdInfo, from time.Time, to time.Time, r *model.Report) error {
+	history, err := s.eventsRepository.GetAdStatusHistory(ctx, adInfo.TweetId.String())
+	if err != nil {
+		return err
+	}
+
+	scheduleHistory, err := s.eventsRepository.GetAdScheduleHistory(ctx, adInfo.TweetId.String())
+	if err != nil {
+		return err
+	}
+
+	loc := adLocation(adInfo)
+	r.ActiveDays = activeDays(adInfo, history, from, to, loc)
+	r.ScheduledHours = scheduledHours(adInfo, history, scheduleHistory, from, to, loc)
+
+	r.DeliveredHours, err = s.reportsRepository.GetDeliveredHours(ctx, adInfo.TweetId.String(), from, to)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *AdsService) GetAudienceBreakdown(ctx context.Context, tweetId string, from time.Time, to time.Time) (*model.AudienceBreakdown, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.GetAudienceBreakdown")
+	defer span.End()
+
+	if to.Before(from) {
+		span.SetStatus(codes.Error, "Invalid date range")
+		return nil, &app_errors.AppError{422, "Invalid date range"}
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	adInfo, err := s.eventsRepository.GetAdInfo(serviceCtx, tweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	if adInfo.PostedBy != authUser.Username {
+		span.SetStatus(codes.Error, fmt.Sprintf("User %s doesn't have access!", authUser.Username))
+		return nil, &app_errors.AppError{403, ""}
+	}
+
+	b, err := s.reportsRepository.GetAudienceBreakdown(serviceCtx, tweetId, from, to)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	b.From = from.Format("2006-01-02")
+	b.To = to.Format("2006-01-02")
+
+	total := b.Total.Likes + b.Total.Views + b.Total.Visits
+	if total > 0 {
+		b.OnTargetPercent = float64(b.OnTarget.Likes+b.OnTarget.Views+b.OnTarget.Visits) / float64(total) * 100
+	}
+
+	return b, nil
+}
+
+// AddEvents ingests a batch of view and visit events of the caller, possibly about different tweets.
+func (s *AdsService) AddEvents(ctx context.Context, events []model.BatchEvent) ([]model.BatchEventResult, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "AdsService.AddEvents")
+	defer span.End()
+
+	if len(events) > maxBatchEvents {
+		span.SetStatus(codes.Error, fmt.Sprintf("Batch of %d events", len(events)))
+		return nil, &app_errors.AppError{413, fmt.Sprintf("At most %d events per batch", maxBatchEvents)}
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	results := make([]model.BatchEventResult, len(events))
+	items := make([]*batchItem, len(events))
+
+	for i, e := range events {
+		results[i].Index = i
+		items[i] = &batchItem{
+			event: model.ReportEvent{
+				Kind:     e.Type,
+				TweetId:  e.TweetId,
+				Username: authUser.Username,
+				ViewTime: int64(e.ViewTime),
+			},
+			eventKey:   e.EventKey,
+			occurredAt: e.OccurredAt,
+			result:     &results[i],
+		}
+
+		if e.Type != model.VIEW_EVENT && e.Type != model.VISIT_EVENT {
+			items[i].fail(422, "Unknown event type", nil)
+			continue
+		}
+
+		tweetId, err := gocql.ParseUUID(e.TweetId)
+		if err != nil {
+			items[i].fail(422, "Invalid UUID", err)
+			continue
+		}
+		items[i].tweetId = tweetId
+
+		if len(e.EventKey) > maxEventKeyLength {
+			items[i].fail(422, "Idempotency key too long", nil)
+		}
+	}
+
+	d, err := resolveDemographics(serviceCtx, s.eventsRepository, authUser.Username, authUser.Demographics)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	ingestBatch(serviceCtx, s.eventsRepository, s.aggregator, items, func(string) (model.Demographics, error) {
+		return d, nil
+	})
+
+	return results, nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/gocql/gocql"
+	"sort"
+	"time"
+)
+
+const (
+	defaultPostViewWindow       = 24 * time.Hour
+	defaultPostEngagementWindow = 7 * 24 * time.Hour
+)
+
+var (
+	// postViewWindow is how long after seeing an ad a conversion is still credited to it.
+	postViewWindow = envDuration("ATTRIBUTION_POST_VIEW_WINDOW", defaultPostViewWindow)
+	// postEngagementWindow is how long after clicking or liking an ad a conversion is still credited to it.
+	postEngagementWindow = envDuration("ATTRIBUTION_POST_ENGAGEMENT_WINDOW", defaultPostEngagementWindow)
+)
+
+// attributionLookback is how far before an event its attribution can reach.
+func attributionLookback() time.Duration {
+	if postViewWindow > postEngagementWindow {
+		return postViewWindow
+	}
+	return postEngagementWindow
+}
+
+// isConversion reports whether an event kind is credited to prior contact with the ad.
+func isConversion(kind string) bool {
+	switch kind {
+	case model.VISIT_EVENT, model.LIKE_EVENT, model.CONVERSION_EVENT:
+		return true
+	}
+	return false
+}
+
+// touchpointKind returns the kind of contact with the ad an event is, or "" when it's none.
+func touchpointKind(kind string) string {
+	switch kind {
+	case model.VIEW_EVENT:
+		return model.VIEW_TOUCHPOINT
+	case model.CLICK_EVENT, model.LIKE_EVENT:
+		return model.ENGAGEMENT_TOUCHPOINT
+	}
+	return ""
+}
+
+func touchpointWindow(kind string) time.Duration {
+	if kind == model.VIEW_TOUCHPOINT {
+		return postViewWindow
+	}
+	return postEngagementWindow
+}
+
+// attributeEvent credits a conversion to the ad when the user saw or engaged with it within the windows before,
+// and records the event as contact with the ad when it is one. A like is checked before it's recorded so it doesn't
+// credit itself. Contact from before touchpoints were recorded is only seen once backfill-touchpoints has run.
+func attributeEvent(ctx context.Context, eventsRepository repository.EventsRepository, tweetId gocql.UUID, e *model.ReportEvent, occurredAt time.Time) error {
+	if isConversion(e.Kind) {
+		for _, kind := range []string{model.VIEW_TOUCHPOINT, model.ENGAGEMENT_TOUCHPOINT} {
+			found, err := eventsRepository.HasTouchpoint(ctx, tweetId, e.Username, kind, occurredAt.Add(-touchpointWindow(kind)), occurredAt)
+			if err != nil {
+				return err
+			}
+			if found {
+				e.Attributed = true
+				break
+			}
+		}
+	}
+
+	if kind := touchpointKind(e.Kind); kind != "" {
+		return eventsRepository.SaveTouchpoint(ctx, tweetId, e.Username, kind, occurredAt, touchpointWindow(kind))
+	}
+
+	return nil
+}
+
+// attributeEvents credits the conversions among stored events the same way attributeEvent does on ingestion, events
+// have to reach back attributionLookback before the first conversion that is looked at.
+func attributeEvents(events []model.ReportEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+
+	last := map[string]map[string]time.Time{}
+
+	for i := range events {
+		e := &events[i]
+
+		// late events are stored at when they arrived, they're only counted apart and aren't touchpoints
+		if e.Late {
+			continue
+		}
+
+		if isConversion(e.Kind) {
+			for kind, at := range last[e.Username] {
+				if !e.Time.After(at.Add(touchpointWindow(kind))) {
+					e.Attributed = true
+					break
+				}
+			}
+		}
+
+		if kind := touchpointKind(e.Kind); kind != "" {
+			if last[e.Username] == nil {
+				last[e.Username] = map[string]time.Time{}
+			}
+			last[e.Username][kind] = e.Time
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"strings"
+)
+
+var ageBrackets = []struct {
+	max  int32
+	name string
+}{
+	{17, "13-17"},
+	{24, "18-24"},
+	{34, "25-34"},
+	{44, "35-44"},
+	{54, "45-54"},
+	{64, "55-64"},
+}
+
+func ageBracket(age int32) string {
+	if age <= 0 {
+		return ""
+	}
+
+	for _, b := range ageBrackets {
+		if age <= b.max {
+			return b.name
+		}
+	}
+
+	return "65+"
+}
+
+// isOnTarget reports whether a viewer matches the targeting of an ad, unknown demographics never match a set criterion.
+func isOnTarget(adInfo *model.AdInfo, d model.Demographics) bool {
+	if adInfo == nil {
+		return false
+	}
+
+	if adInfo.Town != "" && !strings.EqualFold(adInfo.Town, d.Town) {
+		return false
+	}
+
+	if adInfo.Gender != "" && !strings.EqualFold(adInfo.Gender, d.Gender) {
+		return false
+	}
+
+	if adInfo.MinAge > 0 && (d.Age == 0 || d.Age < adInfo.MinAge) {
+		return false
+	}
+
+	if adInfo.MaxAge > 0 && (d.Age == 0 || d.Age > adInfo.MaxAge) {
+		return false
+	}
+
+	return true
+}
+
+// resolveDemographics prefers the demographics from the viewer's token and remembers them for events that don't
+// carry any, like likes coming over gRPC.
+func resolveDemographics(ctx context.Context, eventsRepository repository.EventsRepository, username string, fromToken model.Demographics) (model.Demographics, error) {
+	if fromToken != (model.Demographics{}) {
+		err := eventsRepository.SaveViewerDemographics(ctx, username, &fromToken)
+		return fromToken, err
+	}
+
+	d, err := eventsRepository.GetViewerDemographics(ctx, username)
+	if err != nil {
+		return model.Demographics{}, err
+	}
+
+	return *d, nil
+}
+
+func audienceSegment(adInfo *model.AdInfo, d model.Demographics) model.AudienceSegment {
+	return model.AudienceSegment{
+		AgeBracket: ageBracket(d.Age),
+		Gender:     d.Gender,
+		Town:       d.Town,
+		OnTarget:   isOnTarget(adInfo, d),
+	}
+}
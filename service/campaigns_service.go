@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/app_errors"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const maxCampaignNameLength = 100
+
+type CampaignsService struct {
+	eventsRepository  repository.EventsRepository
+	reportsRepository repository.ReportsRepository
+	tracer            trace.Tracer
+}
+
+func NewCampaignsService(eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, tracer trace.Tracer) *CampaignsService {
+	return &CampaignsService{
+		eventsRepository,
+		reportsRepository,
+		tracer,
+	}
+}
+
+func (s *CampaignsService) CreateCampaign(ctx context.Context, campaign model.Campaign) (*model.Campaign, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "CampaignsService.CreateCampaign")
+	defer span.End()
+
+	appErr := validateCampaign(&campaign)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	campaign.Id = gocql.TimeUUID()
+	campaign.Owner = authUser.Username
+	campaign.TweetIds = []string{}
+
+	err := s.eventsRepository.SaveCampaign(serviceCtx, &campaign)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	return &campaign, nil
+}
+
+func (s *CampaignsService) GetCampaigns(ctx context.Context) ([]model.Campaign, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "CampaignsService.GetCampaigns")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	campaigns, err := s.eventsRepository.GetCampaigns(serviceCtx, authUser.Username)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	for i := range campaigns {
+		campaigns[i].TweetIds, err = s.eventsRepository.GetCampaignTweetIds(serviceCtx, campaigns[i].Id.String())
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, &app_errors.AppError{500, ""}
+		}
+	}
+
+	return campaigns, nil
+}
+
+func (s *CampaignsService) GetCampaign(ctx context.Context, campaignId string) (*model.Campaign, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "CampaignsService.GetCampaign")
+	defer span.End()
+
+	campaign, appErr := s.ownCampaign(serviceCtx, campaignId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	tweetIds, err := s.eventsRepository.GetCampaignTweetIds(serviceCtx, campaignId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	campaign.TweetIds = tweetIds
+
+	return campaign, nil
+}
+
+func (s *CampaignsService) UpdateCampaign(ctx context.Context, campaignId string, update model.Campaign) (*model.Campaign, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "CampaignsService.UpdateCampaign")
+	defer span.End()
+
+	appErr := validateCampaign(&update)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	campaign, appErr := s.ownCampaign(serviceCtx, campaignId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	campaign.Name = update.Name
+	campaign.Objective = update.Objective
+	campaign.StartDate = update.StartDate
+	campaign.EndDate = update.EndDate
+
+	err := s.eventsRepository.SaveCampaign(serviceCtx, campaign)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	campaign.TweetIds, err = s.eventsRepository.GetCampaignTweetIds(serviceCtx, campaignId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	return campaign, nil
+}
+
+// DeleteCampaign deletes a campaign, its tweets stay promoted with their own reports.
+func (s *CampaignsService) DeleteCampaign(ctx context.Context, campaignId string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "CampaignsService.DeleteCampaign")
+	defer span.End()
+
+	campaign, appErr := s.ownCampaign(serviceCtx, campaignId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	err := s.eventsRepository.DeleteCampaign(serviceCtx, campaign.Owner, campaignId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{500, ""}
+	}
+
+	return nil
+}
+
+// AddCampaignAd moves an ad of the user into a campaign, out of the one it was in.
+func (s *CampaignsService) AddCampaignAd(ctx context.Context, campaignId string, tweetId string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "CampaignsService.AddCampaignAd")
+	defer span.End()
+
+	_, appErr := s.ownCampaign(serviceCtx, campaignId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	adInfo, appErr := s.ownAd(serviceCtx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	err := s.eventsRepository.SetAdCampaign(serviceCtx, tweetId, adInfo.CampaignId, campaignId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{500, ""}
+	}
+
+	return nil
+}
+
+func (s *CampaignsService) RemoveCampaignAd(ctx context.Context, campaignId string, tweetId string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "CampaignsService.RemoveCampaignAd")
+	defer span.End()
+
+	_, appErr := s.ownCampaign(serviceCtx, campaignId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	adInfo, appErr := s.ownAd(serviceCtx, tweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return appErr
+	}
+
+	if adInfo.CampaignId != campaignId {
+		span.SetStatus(codes.Error, "Ad isn't in the campaign")
+		return &app_errors.AppError{404, "Ad isn't in the campaign"}
+	}
+
+	err := s.eventsRepository.SetAdCampaign(serviceCtx, tweetId, campaignId, "")
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{500, ""}
+	}
+
+	return nil
+}
+
+func (s *CampaignsService) GetCampaignMonthlyReport(ctx context.Context, campaignId string, year int64, month int64) (*model.CampaignReport, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "CampaignsService.GetCampaignMonthlyReport")
+	defer span.End()
+
+	tweetIds, appErr := s.ownCampaignTweetIds(serviceCtx, campaignId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	r, err := s.reportsRepository.GetCampaignMonthlyReport(serviceCtx, tweetIds, year, month)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	r.CampaignId = campaignId
+
+	return r, nil
+}
+
+func (s *CampaignsService) GetCampaignDailyReport(ctx context.Context, campaignId string, year int64, month int64, day int64) (*model.CampaignReport, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "CampaignsService.GetCampaignDailyReport")
+	defer span.End()
+
+	tweetIds, appErr := s.ownCampaignTweetIds(serviceCtx, campaignId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	r, err := s.reportsRepository.GetCampaignDailyReport(serviceCtx, tweetIds, year, month, day)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	r.CampaignId = campaignId
+
+	return r, nil
+}
+
+// ownCampaign reads a campaign of the user, campaigns are stored under their owner so other users' ones aren't found.
+func (s *CampaignsService) ownCampaign(ctx context.Context, campaignId string) (*model.Campaign, *app_errors.AppError) {
+	_, err := gocql.ParseUUID(campaignId)
+	if err != nil {
+		return nil, &app_errors.AppError{422, "Invalid UUID"}
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	campaign, err := s.eventsRepository.GetCampaign(ctx, authUser.Username, campaignId)
+	if err == gocql.ErrNotFound {
+		return nil, &app_errors.AppError{404, "Campaign not found"}
+	}
+	if err != nil {
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	return campaign, nil
+}
+
+func (s *CampaignsService) ownCampaignTweetIds(ctx context.Context, campaignId string) ([]string, *app_errors.AppError) {
+	_, appErr := s.ownCampaign(ctx, campaignId)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	tweetIds, err := s.eventsRepository.GetCampaignTweetIds(ctx, campaignId)
+	if err != nil {
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	return tweetIds, nil
+}
+
+func (s *CampaignsService) ownAd(ctx context.Context, tweetId string) (*model.AdInfo, *app_errors.AppError) {
+	_, err := gocql.ParseUUID(tweetId)
+	if err != nil {
+		return nil, &app_errors.AppError{422, "Invalid UUID"}
+	}
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	adInfo, err := s.eventsRepository.GetAdInfo(ctx, tweetId)
+	if err != nil {
+		return nil, &app_errors.AppError{500, ""}
+	}
+
+	if adInfo.PostedBy != authUser.Username {
+		return nil, &app_errors.AppError{403, ""}
+	}
+
+	return adInfo, nil
+}
+
+func validateCampaign(campaign *model.Campaign) *app_errors.AppError {
+	if campaign.Name == "" || len(campaign.Name) > maxCampaignNameLength {
+		return &app_errors.AppError{422, fmt.Sprintf("Name must be 1 to %d characters long", maxCampaignNameLength)}
+	}
+
+	switch campaign.Objective {
+	case model.AWARENESS_OBJECTIVE, model.ENGAGEMENT_OBJECTIVE, model.TRAFFIC_OBJECTIVE, model.FOLLOWERS_OBJECTIVE:
+	default:
+		return &app_errors.AppError{422, "Unknown objective"}
+	}
+
+	start, err := time.Parse("2006-01-02", campaign.StartDate)
+	if err != nil {
+		return &app_errors.AppError{422, "Invalid start date"}
+	}
+
+	if campaign.EndDate != "" {
+		end, err := time.Parse("2006-01-02", campaign.EndDate)
+		if err != nil {
+			return &app_errors.AppError{422, "Invalid end date"}
+		}
+
+		if end.Before(start) {
+			return &app_errors.AppError{422, "End date is before start date"}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/gocql/gocql"
+	"os"
+	"time"
+)
+
+const (
+	defaultDedupeWindow   = 24 * time.Hour
+	defaultMaxClockSkew   = 5 * time.Minute
+	defaultLatenessCutoff = 7 * 24 * time.Hour
+	maxEventKeyLength     = 128
+)
+
+var (
+	// dedupeWindow is how long event keys are remembered, a retry arriving later is counted again.
+	dedupeWindow = envDuration("EVENT_DEDUPE_WINDOW", defaultDedupeWindow)
+	// maxClockSkew is how far in the future a producer's clock may put an event.
+	maxClockSkew = envDuration("EVENT_MAX_CLOCK_SKEW", defaultMaxClockSkew)
+	// latenessCutoff is how old an event may be to still be counted when it happened.
+	latenessCutoff = envDuration("EVENT_LATENESS_CUTOFF", defaultLatenessCutoff)
+	// countLateEvents keeps events past the cutoff and counts them apart instead of rejecting them.
+	countLateEvents = os.Getenv("EVENT_LATE_POLICY") == "count"
+)
+
+var (
+	ErrEventFromFuture = errors.New("event time is in the future")
+	ErrEventTooLate    = errors.New("event is past the lateness cutoff")
+)
+
+// lookupAd returns the ad info of the tweet an event is about, or nil when the tweet isn't an ad.
+func lookupAd(ctx context.Context, eventsRepository repository.EventsRepository, tweetId string) (*model.AdInfo, error) {
+	adInfo, err := eventsRepository.GetAdInfo(ctx, tweetId)
+	if err == gocql.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return adInfo, nil
+}
+
+// claimEvent reports whether an event is seen for the first time, events sent without a key always are.
+func claimEvent(ctx context.Context, eventsRepository repository.EventsRepository, tweetId gocql.UUID, kind string, username string, eventKey string) (bool, error) {
+	if eventKey == "" {
+		return true, nil
+	}
+
+	return eventsRepository.ClaimEventKey(ctx, tweetId, kind, username, eventKey, dedupeWindow)
+}
+
+// releaseEvent lets a retry through again when the event couldn't be stored or counted after it was claimed.
+func releaseEvent(ctx context.Context, eventsRepository repository.EventsRepository, tweetId gocql.UUID, kind string, username string, eventKey string) {
+	if eventKey == "" {
+		return
+	}
+
+	_ = eventsRepository.ReleaseEventKey(ctx, tweetId, kind, username, eventKey)
+}
+
+// eventTime returns when an event happened in loc, the time the producer sent or now when it sent none.
+// late is set for events past the lateness cutoff that are kept anyway, they are counted on the day they arrived.
+func eventTime(occurredAt time.Time, loc *time.Location) (t time.Time, late bool, err error) {
+	now := time.Now()
+
+	if occurredAt.IsZero() {
+		return now.In(loc), false, nil
+	}
+
+	if occurredAt.After(now.Add(maxClockSkew)) {
+		return time.Time{}, false, ErrEventFromFuture
+	}
+
+	if occurredAt.Before(now.Add(-latenessCutoff)) {
+		if !countLateEvents {
+			return time.Time{}, false, ErrEventTooLate
+		}
+		return occurredAt.In(loc), true, nil
+	}
+
+	return occurredAt.In(loc), false, nil
+}
+
+// reportEventTime is the time an event is counted at, late events are counted when they arrived.
+func reportEventTime(occurred time.Time, late bool) time.Time {
+	if late {
+		return time.Now().In(occurred.Location())
+	}
+
+	return occurred
+}
+
+func isClickType(clickType string) bool {
+	switch clickType {
+	case model.LINK_CLICK, model.MEDIA_CLICK, model.HASHTAG_CLICK:
+		return true
+	}
+	return false
+}
+
+func isConversionType(conversionType string) bool {
+	switch conversionType {
+	case model.RETWEET_CONVERSION, model.REPLY_CONVERSION, model.FOLLOW_CONVERSION:
+		return true
+	}
+	return false
+}
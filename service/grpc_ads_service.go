@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"github.com/FTN-TwitterClone/ads/model"
 	"github.com/FTN-TwitterClone/ads/repository"
 	"github.com/FTN-TwitterClone/grpc-stubs/proto/ads"
@@ -9,6 +10,9 @@ import (
 	"github.com/golang/protobuf/ptypes/empty"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	grpcCodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"time"
 )
 
@@ -17,13 +21,15 @@ type gRPCAdsService struct {
 	tracer            trace.Tracer
 	eventsRepository  repository.EventsRepository
 	reportsRepository repository.ReportsRepository
+	aggregator        *ReportAggregator
 }
 
-func NewgRPCAdsService(tracer trace.Tracer, eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository) *gRPCAdsService {
+func NewgRPCAdsService(tracer trace.Tracer, eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, aggregator *ReportAggregator) *gRPCAdsService {
 	return &gRPCAdsService{
 		tracer:            tracer,
 		eventsRepository:  eventsRepository,
 		reportsRepository: reportsRepository,
+		aggregator:        aggregator,
 	}
 }
 
@@ -46,89 +52,213 @@ func (s *gRPCAdsService) SaveAdInfo(ctx context.Context, adInfo *ads.AdInfo) (*e
 		Gender:   adInfo.Gender,
 	}
 
-	err = s.eventsRepository.SaveAdInfo(serviceCtx, &a)
-	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		return nil, err
+	targeting := adTargeting(&a)
+	if appErr := validateTargeting(&targeting); appErr != nil {
+		span.SetStatus(codes.Error, appErr.Message)
+		return nil, status.Error(grpcCodes.InvalidArgument, appErr.Message)
 	}
+	a.Town = targeting.Town
+	a.Gender = targeting.Gender
 
-	return new(empty.Empty), nil
-}
+	initialStatus := incomingAdStatus(ctx)
+	if initialStatus != model.AD_DRAFT && initialStatus != model.AD_ACTIVE {
+		span.SetStatus(codes.Error, fmt.Sprintf("Unknown initial status %s", initialStatus))
+		return nil, status.Error(grpcCodes.InvalidArgument, "Ads start as draft or active")
+	}
 
-func (s *gRPCAdsService) SaveLikeEvent(ctx context.Context, likeEvent *ads.LikeEvent) (*empty.Empty, error) {
-	serviceCtx, span := s.tracer.Start(ctx, "gRPCAdsService.SaveLikeEvent")
-	defer span.End()
+	campaignId := incomingCampaignId(ctx)
+	if campaignId != "" {
+		var id gocql.UUID
+		id, err = gocql.ParseUUID(campaignId)
+		if err == nil {
+			campaignId = id.String()
+			_, err = s.eventsRepository.GetCampaign(serviceCtx, a.PostedBy, campaignId)
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, status.Error(grpcCodes.InvalidArgument, "Unknown campaign")
+		}
+	}
 
-	tweetId, err := gocql.ParseUUID(likeEvent.TweetId)
+	// campaign, status and timezone aren't written by SaveAdInfo, an ad saved again keeps them unless it's moved and a
+	// changed targeting becomes a new version
+	previous, err := lookupAd(serviceCtx, s.eventsRepository, adInfo.TweetId)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
-	now := time.Now()
+	// an ad stays with the user who posted it, saving it again under another user would take it over
+	if previous != nil && previous.PostedBy != a.PostedBy {
+		span.SetStatus(codes.Error, fmt.Sprintf("User %s doesn't have access!", a.PostedBy))
+		return nil, status.Error(grpcCodes.PermissionDenied, "")
+	}
 
-	e := model.TweetLikedEvent{
-		Username: likeEvent.Username,
-		TweetId:  tweetId,
-		Time:     now,
+	previousCampaignId := ""
+	if previous != nil {
+		previousCampaignId = previous.CampaignId
 	}
 
-	err = s.eventsRepository.SaveTweetLikedEvent(serviceCtx, &e)
+	err = s.eventsRepository.SaveAdInfo(serviceCtx, &a)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
-	err = s.reportsRepository.UpsertMonthlyReportLikesCount(serviceCtx, likeEvent.TweetId, int64(now.Year()), int64(now.Month()))
+	// the lifecycle of a new ad starts when its tweet was posted
+	if previous == nil {
+		err = s.eventsRepository.UpdateAdStatus(serviceCtx, adInfo.TweetId, &model.AdStatusChange{
+			Status:    initialStatus,
+			ChangedAt: tweetId.Time(),
+			ChangedBy: adInfo.PostedBy,
+		})
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+
+		err = s.eventsRepository.UpdateAdTargeting(serviceCtx, adInfo.TweetId, &model.AdTargetingVersion{
+			AdTargeting: adTargeting(&a),
+			ValidFrom:   tweetId.Time(),
+			ChangedBy:   adInfo.PostedBy,
+		})
+	} else if adTargeting(previous) != adTargeting(&a) {
+		err = changeAdTargeting(serviceCtx, s.eventsRepository, previous, &model.AdTargetingVersion{
+			AdTargeting: adTargeting(&a),
+			ValidFrom:   time.Now(),
+			ChangedBy:   adInfo.PostedBy,
+		})
+	}
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
-	err = s.reportsRepository.UpsertDailyReportLikesCount(serviceCtx, likeEvent.TweetId, int64(now.Year()), int64(now.Month()), int64(now.Day()))
-	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		return nil, err
+	if campaignId != "" && campaignId != previousCampaignId {
+		err = s.eventsRepository.SetAdCampaign(serviceCtx, adInfo.TweetId, previousCampaignId, campaignId)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
 	}
 
 	return new(empty.Empty), nil
 }
 
-func (s *gRPCAdsService) SaveUnlikeEvent(ctx context.Context, unlikeEvent *ads.UnlikeEvent) (*empty.Empty, error) {
+func (s *gRPCAdsService) SaveLikeEvent(ctx context.Context, likeEvent *ads.LikeEvent) (*empty.Empty, error) {
 	serviceCtx, span := s.tracer.Start(ctx, "gRPCAdsService.SaveLikeEvent")
 	defer span.End()
 
-	tweetId, err := gocql.ParseUUID(unlikeEvent.TweetId)
-	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		return nil, err
-	}
+	return s.saveEvent(serviceCtx, span, model.ReportEvent{
+		Kind:     model.LIKE_EVENT,
+		TweetId:  likeEvent.TweetId,
+		Username: likeEvent.Username,
+	})
+}
 
-	now := time.Now()
+func (s *gRPCAdsService) SaveUnlikeEvent(ctx context.Context, unlikeEvent *ads.UnlikeEvent) (*empty.Empty, error) {
+	serviceCtx, span := s.tracer.Start(ctx, "gRPCAdsService.SaveUnlikeEvent")
+	defer span.End()
 
-	e := model.TweetUnlikedEvent{
+	return s.saveEvent(serviceCtx, span, model.ReportEvent{
+		Kind:     model.UNLIKE_EVENT,
+		TweetId:  unlikeEvent.TweetId,
 		Username: unlikeEvent.Username,
-		TweetId:  tweetId,
-		Time:     now,
-	}
+	})
+}
 
-	err = s.eventsRepository.SaveTweetUnlikedEvent(serviceCtx, &e)
+// saveEvent ingests one event sent over gRPC, e has its kind, tweet, user and the fields of that kind set. When it
+// happened and its idempotency key come from the metadata.
+func (s *gRPCAdsService) saveEvent(ctx context.Context, span trace.Span, e model.ReportEvent) (*empty.Empty, error) {
+	tweetId, err := gocql.ParseUUID(e.TweetId)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return nil, err
+		return nil, status.Error(grpcCodes.InvalidArgument, "Invalid UUID")
 	}
 
-	err = s.reportsRepository.UpsertMonthlyReportUnlikesCount(serviceCtx, unlikeEvent.TweetId, int64(now.Year()), int64(now.Month()))
+	sentAt, err := incomingEventTime(ctx)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return nil, err
+		return nil, status.Error(grpcCodes.InvalidArgument, err.Error())
 	}
 
-	err = s.reportsRepository.UpsertDailyReportUnlikesCount(serviceCtx, unlikeEvent.TweetId, int64(now.Year()), int64(now.Month()), int64(now.Day()))
+	eventKey, err := incomingEventKey(ctx)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
+	item := ingestEvent(ctx, s.eventsRepository, s.aggregator, tweetId, e, eventKey, sentAt, func(username string) (model.Demographics, error) {
+		return resolveDemographics(ctx, s.eventsRepository, username, model.Demographics{})
+	})
+	if item.result.Status != 200 {
+		span.SetStatus(codes.Error, item.cause.Error())
+		return nil, status.Error(batchResultCode(item.result.Status), item.result.Error)
+	}
+
 	return new(empty.Empty), nil
 }
+
+// incomingEventKey reads the idempotency key callers can send as gRPC metadata, the stubs don't carry one.
+func incomingEventKey(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil
+	}
+
+	keys := md.Get("idempotency-key")
+	if len(keys) == 0 {
+		return "", nil
+	}
+
+	if len(keys[0]) > maxEventKeyLength {
+		return "", status.Error(grpcCodes.InvalidArgument, "Idempotency key too long")
+	}
+
+	return keys[0], nil
+}
+
+// incomingAdStatus reads the status a new ad starts in from the ad-status metadata, ads start active by default.
+func incomingAdStatus(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return model.AD_ACTIVE
+	}
+
+	statuses := md.Get("ad-status")
+	if len(statuses) == 0 {
+		return model.AD_ACTIVE
+	}
+
+	return statuses[0]
+}
+
+// incomingCampaignId reads the campaign an ad is saved into from the campaign-id metadata.
+func incomingCampaignId(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	ids := md.Get("campaign-id")
+	if len(ids) == 0 {
+		return ""
+	}
+
+	return ids[0]
+}
+
+// incomingEventTime reads when an event happened from the event-time metadata, an RFC 3339 timestamp.
+func incomingEventTime(ctx context.Context) (time.Time, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	times := md.Get("event-time")
+	if len(times) == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, times[0])
+}
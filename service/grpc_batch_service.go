@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/grpc-stubs/proto/ads"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	grpcCodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+)
+
+// adsBatchServiceServer serves proto/ads_batch_service.proto, the descriptor is written by hand until the shared
+// stubs are generated from it.
+type adsBatchServiceServer interface {
+	StreamLikeEvents(stream grpc.ServerStream) error
+	StreamUnlikeEvents(stream grpc.ServerStream) error
+}
+
+var adsBatchServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ads.AdsBatchService",
+	HandlerType: (*adsBatchServiceServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "StreamLikeEvents",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(adsBatchServiceServer).StreamLikeEvents(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName: "StreamUnlikeEvents",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(adsBatchServiceServer).StreamUnlikeEvents(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ads_batch_service.proto",
+}
+
+func RegisterAdsBatchServiceServer(s *grpc.Server, srv *gRPCAdsService) {
+	s.RegisterService(&adsBatchServiceDesc, srv)
+}
+
+func (s *gRPCAdsService) StreamLikeEvents(stream grpc.ServerStream) error {
+	return s.streamEvents(stream, "gRPCAdsService.StreamLikeEvents", model.LIKE_EVENT, func() (string, string, error) {
+		var e ads.LikeEvent
+		err := stream.RecvMsg(&e)
+		return e.TweetId, e.Username, err
+	})
+}
+
+func (s *gRPCAdsService) StreamUnlikeEvents(stream grpc.ServerStream) error {
+	return s.streamEvents(stream, "gRPCAdsService.StreamUnlikeEvents", model.UNLIKE_EVENT, func() (string, string, error) {
+		var e ads.UnlikeEvent
+		err := stream.RecvMsg(&e)
+		return e.TweetId, e.Username, err
+	})
+}
+
+func (s *gRPCAdsService) streamEvents(stream grpc.ServerStream, spanName string, kind string, recv func() (string, string, error)) error {
+	ctx, span := s.tracer.Start(stream.Context(), spanName)
+	defer span.End()
+
+	streamKey, err := incomingEventKey(stream.Context())
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	demographics := map[string]model.Demographics{}
+
+	var items []*batchItem
+
+	flush := func() error {
+		ingestBatch(ctx, s.eventsRepository, s.aggregator, items, func(username string) (model.Demographics, error) {
+			d, ok := demographics[username]
+			if !ok {
+				var err error
+				d, err = resolveDemographics(ctx, s.eventsRepository, username, model.Demographics{})
+				if err != nil {
+					return d, err
+				}
+				demographics[username] = d
+			}
+			return d, nil
+		})
+
+		for _, item := range items {
+			err := stream.SendMsg(status.New(batchResultCode(item.result.Status), item.result.Error).Proto())
+			if err != nil {
+				return err
+			}
+		}
+
+		items = items[:0]
+		return nil
+	}
+
+	for n := 0; ; n++ {
+		tweetId, username, err := recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		item := &batchItem{
+			event: model.ReportEvent{
+				Kind:     kind,
+				TweetId:  tweetId,
+				Username: username,
+			},
+			result: &model.BatchEventResult{Index: n},
+		}
+		if streamKey != "" {
+			item.eventKey = fmt.Sprintf("%s/%d", streamKey, n)
+		}
+
+		item.tweetId, err = gocql.ParseUUID(tweetId)
+		if err != nil {
+			item.fail(422, "Invalid UUID", err)
+		}
+
+		items = append(items, item)
+
+		if len(items) == maxBatchEvents {
+			err = flush()
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+		}
+	}
+
+	err = flush()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func batchResultCode(httpStatus int) grpcCodes.Code {
+	switch httpStatus {
+	case 200:
+		return grpcCodes.OK
+	case 422:
+		return grpcCodes.InvalidArgument
+	case 409:
+		return grpcCodes.FailedPrecondition
+	case 503:
+		return grpcCodes.Unavailable
+	default:
+		return grpcCodes.Internal
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/empty"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	grpcCodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClickEvent is the ClickEvent message of proto/ads_click_service.proto, written by hand until the shared stubs
+// are generated from it.
+type ClickEvent struct {
+	TweetId   string `protobuf:"bytes,1,opt,name=TweetId,proto3" json:"TweetId,omitempty"`
+	Username  string `protobuf:"bytes,2,opt,name=Username,proto3" json:"Username,omitempty"`
+	ClickType string `protobuf:"bytes,3,opt,name=ClickType,proto3" json:"ClickType,omitempty"`
+}
+
+func (m *ClickEvent) Reset()         { *m = ClickEvent{} }
+func (m *ClickEvent) String() string { return proto.CompactTextString(m) }
+func (*ClickEvent) ProtoMessage()    {}
+
+type adsClickServiceServer interface {
+	SaveClickEvent(ctx context.Context, clickEvent *ClickEvent) (*empty.Empty, error)
+}
+
+var adsClickServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ads.AdsClickService",
+	HandlerType: (*adsClickServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SaveClickEvent",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(ClickEvent)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(adsClickServiceServer).SaveClickEvent(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: "/ads.AdsClickService/SaveClickEvent",
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(adsClickServiceServer).SaveClickEvent(ctx, req.(*ClickEvent))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+	},
+	Metadata: "ads_click_service.proto",
+}
+
+func RegisterAdsClickServiceServer(s *grpc.Server, srv *gRPCAdsService) {
+	s.RegisterService(&adsClickServiceDesc, srv)
+}
+
+func (s *gRPCAdsService) SaveClickEvent(ctx context.Context, clickEvent *ClickEvent) (*empty.Empty, error) {
+	serviceCtx, span := s.tracer.Start(ctx, "gRPCAdsService.SaveClickEvent")
+	defer span.End()
+
+	if !isClickType(clickEvent.ClickType) {
+		span.SetStatus(codes.Error, fmt.Sprintf("Unknown click type %s", clickEvent.ClickType))
+		return nil, status.Error(grpcCodes.InvalidArgument, "Unknown click type")
+	}
+
+	return s.saveEvent(serviceCtx, span, model.ReportEvent{
+		Kind:      model.CLICK_EVENT,
+		TweetId:   clickEvent.TweetId,
+		Username:  clickEvent.Username,
+		ClickType: clickEvent.ClickType,
+	})
+}
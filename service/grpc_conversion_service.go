@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/empty"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	grpcCodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ConversionEvent is the ConversionEvent message of proto/ads_conversion_service.proto, written by hand until the
+// shared stubs are generated from it.
+type ConversionEvent struct {
+	TweetId        string `protobuf:"bytes,1,opt,name=TweetId,proto3" json:"TweetId,omitempty"`
+	Username       string `protobuf:"bytes,2,opt,name=Username,proto3" json:"Username,omitempty"`
+	ConversionType string `protobuf:"bytes,3,opt,name=ConversionType,proto3" json:"ConversionType,omitempty"`
+}
+
+func (m *ConversionEvent) Reset()         { *m = ConversionEvent{} }
+func (m *ConversionEvent) String() string { return proto.CompactTextString(m) }
+func (*ConversionEvent) ProtoMessage()    {}
+
+type adsConversionServiceServer interface {
+	SaveConversionEvent(ctx context.Context, conversionEvent *ConversionEvent) (*empty.Empty, error)
+}
+
+var adsConversionServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ads.AdsConversionService",
+	HandlerType: (*adsConversionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SaveConversionEvent",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(ConversionEvent)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(adsConversionServiceServer).SaveConversionEvent(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: "/ads.AdsConversionService/SaveConversionEvent",
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(adsConversionServiceServer).SaveConversionEvent(ctx, req.(*ConversionEvent))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+	},
+	Metadata: "ads_conversion_service.proto",
+}
+
+func RegisterAdsConversionServiceServer(s *grpc.Server, srv *gRPCAdsService) {
+	s.RegisterService(&adsConversionServiceDesc, srv)
+}
+
+func (s *gRPCAdsService) SaveConversionEvent(ctx context.Context, conversionEvent *ConversionEvent) (*empty.Empty, error) {
+	serviceCtx, span := s.tracer.Start(ctx, "gRPCAdsService.SaveConversionEvent")
+	defer span.End()
+
+	if !isConversionType(conversionEvent.ConversionType) {
+		span.SetStatus(codes.Error, fmt.Sprintf("Unknown conversion type %s", conversionEvent.ConversionType))
+		return nil, status.Error(grpcCodes.InvalidArgument, "Unknown conversion type")
+	}
+
+	return s.saveEvent(serviceCtx, span, model.ReportEvent{
+		Kind:           model.CONVERSION_EVENT,
+		TweetId:        conversionEvent.TweetId,
+		Username:       conversionEvent.Username,
+		ConversionType: conversionEvent.ConversionType,
+	})
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"github.com/golang/protobuf/proto"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	grpcCodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// ListAdsRequest, AdListing and ListAdsResponse are the messages of proto/ads_list_service.proto, written by hand
+// until the shared stubs are generated from it.
+type ListAdsRequest struct {
+	Username string `protobuf:"bytes,1,opt,name=Username,proto3" json:"Username,omitempty"`
+	Sort     string `protobuf:"bytes,2,opt,name=Sort,proto3" json:"Sort,omitempty"`
+	Limit    int32  `protobuf:"varint,3,opt,name=Limit,proto3" json:"Limit,omitempty"`
+	Cursor   string `protobuf:"bytes,4,opt,name=Cursor,proto3" json:"Cursor,omitempty"`
+}
+
+func (m *ListAdsRequest) Reset()         { *m = ListAdsRequest{} }
+func (m *ListAdsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListAdsRequest) ProtoMessage()    {}
+
+type AdListing struct {
+	TweetId          string  `protobuf:"bytes,1,opt,name=TweetId,proto3" json:"TweetId,omitempty"`
+	PostedBy         string  `protobuf:"bytes,2,opt,name=PostedBy,proto3" json:"PostedBy,omitempty"`
+	Town             string  `protobuf:"bytes,3,opt,name=Town,proto3" json:"Town,omitempty"`
+	MinAge           int32   `protobuf:"varint,4,opt,name=MinAge,proto3" json:"MinAge,omitempty"`
+	MaxAge           int32   `protobuf:"varint,5,opt,name=MaxAge,proto3" json:"MaxAge,omitempty"`
+	Gender           string  `protobuf:"bytes,6,opt,name=Gender,proto3" json:"Gender,omitempty"`
+	Timezone         string  `protobuf:"bytes,7,opt,name=Timezone,proto3" json:"Timezone,omitempty"`
+	CampaignId       string  `protobuf:"bytes,8,opt,name=CampaignId,proto3" json:"CampaignId,omitempty"`
+	CreatedAt        string  `protobuf:"bytes,9,opt,name=CreatedAt,proto3" json:"CreatedAt,omitempty"`
+	Impressions      int64   `protobuf:"varint,10,opt,name=Impressions,proto3" json:"Impressions,omitempty"`
+	Likes            int64   `protobuf:"varint,11,opt,name=Likes,proto3" json:"Likes,omitempty"`
+	ProfileVisits    int64   `protobuf:"varint,12,opt,name=ProfileVisits,proto3" json:"ProfileVisits,omitempty"`
+	Clicks           int64   `protobuf:"varint,13,opt,name=Clicks,proto3" json:"Clicks,omitempty"`
+	Conversions      int64   `protobuf:"varint,14,opt,name=Conversions,proto3" json:"Conversions,omitempty"`
+	UniqueViewers    int64   `protobuf:"varint,15,opt,name=UniqueViewers,proto3" json:"UniqueViewers,omitempty"`
+	EngagementRate   float64 `protobuf:"fixed64,16,opt,name=EngagementRate,proto3" json:"EngagementRate,omitempty"`
+	ClickThroughRate float64 `protobuf:"fixed64,17,opt,name=ClickThroughRate,proto3" json:"ClickThroughRate,omitempty"`
+	ConversionRate   float64 `protobuf:"fixed64,18,opt,name=ConversionRate,proto3" json:"ConversionRate,omitempty"`
+}
+
+func (m *AdListing) Reset()         { *m = AdListing{} }
+func (m *AdListing) String() string { return proto.CompactTextString(m) }
+func (*AdListing) ProtoMessage()    {}
+
+type ListAdsResponse struct {
+	Ads  []*AdListing `protobuf:"bytes,1,rep,name=Ads,proto3" json:"Ads,omitempty"`
+	Next string       `protobuf:"bytes,2,opt,name=Next,proto3" json:"Next,omitempty"`
+}
+
+func (m *ListAdsResponse) Reset()         { *m = ListAdsResponse{} }
+func (m *ListAdsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListAdsResponse) ProtoMessage()    {}
+
+type adsListServiceServer interface {
+	ListAds(ctx context.Context, request *ListAdsRequest) (*ListAdsResponse, error)
+}
+
+var adsListServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ads.AdsListService",
+	HandlerType: (*adsListServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListAds",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(ListAdsRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(adsListServiceServer).ListAds(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: "/ads.AdsListService/ListAds",
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(adsListServiceServer).ListAds(ctx, req.(*ListAdsRequest))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+	},
+	Metadata: "ads_list_service.proto",
+}
+
+func RegisterAdsListServiceServer(s *grpc.Server, srv *gRPCAdsService) {
+	s.RegisterService(&adsListServiceDesc, srv)
+}
+
+func (s *gRPCAdsService) ListAds(ctx context.Context, request *ListAdsRequest) (*ListAdsResponse, error) {
+	serviceCtx, span := s.tracer.Start(ctx, "gRPCAdsService.ListAds")
+	defer span.End()
+
+	q, err := parseAdsQuery(request.Sort, int(request.Limit), request.Cursor)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, status.Error(grpcCodes.InvalidArgument, err.Error())
+	}
+
+	page, err := listAds(serviceCtx, s.eventsRepository, s.reportsRepository, request.Username, q)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	response := &ListAdsResponse{Ads: make([]*AdListing, len(page.Ads)), Next: page.Next}
+	for i, ad := range page.Ads {
+		response.Ads[i] = &AdListing{
+			TweetId:          ad.AdInfo.TweetId.String(),
+			PostedBy:         ad.AdInfo.PostedBy,
+			Town:             ad.AdInfo.Town,
+			MinAge:           ad.AdInfo.MinAge,
+			MaxAge:           ad.AdInfo.MaxAge,
+			Gender:           ad.AdInfo.Gender,
+			Timezone:         ad.AdInfo.Timezone,
+			CampaignId:       ad.AdInfo.CampaignId,
+			CreatedAt:        ad.CreatedAt.Format(time.RFC3339),
+			Impressions:      int64(ad.Lifetime.Impressions),
+			Likes:            int64(ad.Lifetime.LikesCount),
+			ProfileVisits:    int64(ad.Lifetime.ProfileVisits),
+			Clicks:           int64(ad.Lifetime.Clicks),
+			Conversions:      int64(ad.Lifetime.Conversions),
+			UniqueViewers:    int64(ad.Lifetime.UniqueViewers),
+			EngagementRate:   ad.Lifetime.EngagementRate,
+			ClickThroughRate: ad.Lifetime.ClickThroughRate,
+			ConversionRate:   ad.Lifetime.ConversionRate,
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocql/gocql"
+	"github.com/golang/protobuf/proto"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	grpcCodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HourlyReportRequest and HourlyReport are the messages of proto/ads_report_service.proto, written by hand until the
+// shared stubs are generated from it.
+type HourlyReportRequest struct {
+	TweetId  string `protobuf:"bytes,1,opt,name=TweetId,proto3" json:"TweetId,omitempty"`
+	Username string `protobuf:"bytes,2,opt,name=Username,proto3" json:"Username,omitempty"`
+	Year     int64  `protobuf:"varint,3,opt,name=Year,proto3" json:"Year,omitempty"`
+	Month    int64  `protobuf:"varint,4,opt,name=Month,proto3" json:"Month,omitempty"`
+	Day      int64  `protobuf:"varint,5,opt,name=Day,proto3" json:"Day,omitempty"`
+	Hour     int64  `protobuf:"varint,6,opt,name=Hour,proto3" json:"Hour,omitempty"`
+}
+
+func (m *HourlyReportRequest) Reset()         { *m = HourlyReportRequest{} }
+func (m *HourlyReportRequest) String() string { return proto.CompactTextString(m) }
+func (*HourlyReportRequest) ProtoMessage()    {}
+
+type HourlyReport struct {
+	TweetId               string  `protobuf:"bytes,1,opt,name=TweetId,proto3" json:"TweetId,omitempty"`
+	Year                  int64   `protobuf:"varint,2,opt,name=Year,proto3" json:"Year,omitempty"`
+	Month                 int64   `protobuf:"varint,3,opt,name=Month,proto3" json:"Month,omitempty"`
+	Day                   int64   `protobuf:"varint,4,opt,name=Day,proto3" json:"Day,omitempty"`
+	Hour                  int64   `protobuf:"varint,5,opt,name=Hour,proto3" json:"Hour,omitempty"`
+	Likes                 int64   `protobuf:"varint,6,opt,name=Likes,proto3" json:"Likes,omitempty"`
+	Unlikes               int64   `protobuf:"varint,7,opt,name=Unlikes,proto3" json:"Unlikes,omitempty"`
+	ProfileVisits         int64   `protobuf:"varint,8,opt,name=ProfileVisits,proto3" json:"ProfileVisits,omitempty"`
+	Impressions           int64   `protobuf:"varint,9,opt,name=Impressions,proto3" json:"Impressions,omitempty"`
+	Clicks                int64   `protobuf:"varint,10,opt,name=Clicks,proto3" json:"Clicks,omitempty"`
+	LinkClicks            int64   `protobuf:"varint,11,opt,name=LinkClicks,proto3" json:"LinkClicks,omitempty"`
+	MediaClicks           int64   `protobuf:"varint,12,opt,name=MediaClicks,proto3" json:"MediaClicks,omitempty"`
+	HashtagClicks         int64   `protobuf:"varint,13,opt,name=HashtagClicks,proto3" json:"HashtagClicks,omitempty"`
+	Conversions           int64   `protobuf:"varint,14,opt,name=Conversions,proto3" json:"Conversions,omitempty"`
+	Retweets              int64   `protobuf:"varint,15,opt,name=Retweets,proto3" json:"Retweets,omitempty"`
+	Replies               int64   `protobuf:"varint,16,opt,name=Replies,proto3" json:"Replies,omitempty"`
+	Follows               int64   `protobuf:"varint,17,opt,name=Follows,proto3" json:"Follows,omitempty"`
+	AttributedConversions int64   `protobuf:"varint,18,opt,name=AttributedConversions,proto3" json:"AttributedConversions,omitempty"`
+	OrganicConversions    int64   `protobuf:"varint,19,opt,name=OrganicConversions,proto3" json:"OrganicConversions,omitempty"`
+	LateEvents            int64   `protobuf:"varint,20,opt,name=LateEvents,proto3" json:"LateEvents,omitempty"`
+	InactiveEvents        int64   `protobuf:"varint,21,opt,name=InactiveEvents,proto3" json:"InactiveEvents,omitempty"`
+	AverageViewTime       int64   `protobuf:"varint,22,opt,name=AverageViewTime,proto3" json:"AverageViewTime,omitempty"`
+	EngagementRate        float64 `protobuf:"fixed64,23,opt,name=EngagementRate,proto3" json:"EngagementRate,omitempty"`
+	ProfileVisitRate      float64 `protobuf:"fixed64,24,opt,name=ProfileVisitRate,proto3" json:"ProfileVisitRate,omitempty"`
+	ClickThroughRate      float64 `protobuf:"fixed64,25,opt,name=ClickThroughRate,proto3" json:"ClickThroughRate,omitempty"`
+	ConversionRate        float64 `protobuf:"fixed64,26,opt,name=ConversionRate,proto3" json:"ConversionRate,omitempty"`
+}
+
+func (m *HourlyReport) Reset()         { *m = HourlyReport{} }
+func (m *HourlyReport) String() string { return proto.CompactTextString(m) }
+func (*HourlyReport) ProtoMessage()    {}
+
+type adsReportServiceServer interface {
+	GetHourlyReport(ctx context.Context, request *HourlyReportRequest) (*HourlyReport, error)
+}
+
+var adsReportServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ads.AdsReportService",
+	HandlerType: (*adsReportServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetHourlyReport",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(HourlyReportRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(adsReportServiceServer).GetHourlyReport(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: "/ads.AdsReportService/GetHourlyReport",
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(adsReportServiceServer).GetHourlyReport(ctx, req.(*HourlyReportRequest))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+	},
+	Metadata: "ads_report_service.proto",
+}
+
+func RegisterAdsReportServiceServer(s *grpc.Server, srv *gRPCAdsService) {
+	s.RegisterService(&adsReportServiceDesc, srv)
+}
+
+// GetHourlyReport returns the report of an hour of an ad to its owner.
+func (s *gRPCAdsService) GetHourlyReport(ctx context.Context, request *HourlyReportRequest) (*HourlyReport, error) {
+	serviceCtx, span := s.tracer.Start(ctx, "gRPCAdsService.GetHourlyReport")
+	defer span.End()
+
+	tweetId, err := gocql.ParseUUID(request.TweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, status.Error(grpcCodes.InvalidArgument, err.Error())
+	}
+
+	if request.Hour < 0 || request.Hour > 23 {
+		span.SetStatus(codes.Error, "Invalid hour")
+		return nil, status.Error(grpcCodes.InvalidArgument, "Invalid hour")
+	}
+
+	adInfo, err := lookupAd(serviceCtx, s.eventsRepository, tweetId.String())
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if adInfo == nil {
+		span.SetStatus(codes.Error, "Ad not found")
+		return nil, status.Error(grpcCodes.NotFound, "Ad not found")
+	}
+
+	if adInfo.PostedBy != request.Username {
+		span.SetStatus(codes.Error, fmt.Sprintf("User %s doesn't have access!", request.Username))
+		return nil, status.Error(grpcCodes.PermissionDenied, "")
+	}
+
+	r, err := s.reportsRepository.GetHourlyReport(serviceCtx, tweetId.String(), request.Year, request.Month, request.Day, request.Hour)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	report := &HourlyReport{
+		TweetId: tweetId.String(),
+		Year:    request.Year,
+		Month:   request.Month,
+		Day:     request.Day,
+		Hour:    request.Hour,
+	}
+	if r == nil {
+		return report, nil
+	}
+
+	report.Likes = int64(r.LikesCount)
+	report.Unlikes = int64(r.UnlikesCount)
+	report.ProfileVisits = int64(r.ProfileVisits)
+	report.Impressions = int64(r.Impressions)
+	report.Clicks = int64(r.Clicks)
+	report.LinkClicks = int64(r.LinkClicks)
+	report.MediaClicks = int64(r.MediaClicks)
+	report.HashtagClicks = int64(r.HashtagClicks)
+	report.Conversions = int64(r.Conversions)
+	report.Retweets = int64(r.Retweets)
+	report.Replies = int64(r.Replies)
+	report.Follows = int64(r.Follows)
+	report.AttributedConversions = int64(r.AttributedConversions)
+	report.OrganicConversions = int64(r.OrganicConversions)
+	report.LateEvents = int64(r.LateEvents)
+	report.InactiveEvents = int64(r.InactiveEvents)
+	report.AverageViewTime = int64(r.AverageViewTime)
+	report.EngagementRate = r.EngagementRate
+	report.ProfileVisitRate = r.ProfileVisitRate
+	report.ClickThroughRate = r.ClickThroughRate
+	report.ConversionRate = r.ConversionRate
+
+	return report, nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	"github.com/golang/protobuf/proto"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	grpcCodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// IsAdActiveRequest and IsAdActiveResponse are the messages of proto/ads_schedule_service.proto, written by hand
+// until the shared stubs are generated from it.
+type IsAdActiveRequest struct {
+	TweetId string `protobuf:"bytes,1,opt,name=TweetId,proto3" json:"TweetId,omitempty"`
+	At      string `protobuf:"bytes,2,opt,name=At,proto3" json:"At,omitempty"`
+}
+
+func (m *IsAdActiveRequest) Reset()         { *m = IsAdActiveRequest{} }
+func (m *IsAdActiveRequest) String() string { return proto.CompactTextString(m) }
+func (*IsAdActiveRequest) ProtoMessage()    {}
+
+type IsAdActiveResponse struct {
+	Active     bool   `protobuf:"varint,1,opt,name=Active,proto3" json:"Active,omitempty"`
+	Status     string `protobuf:"bytes,2,opt,name=Status,proto3" json:"Status,omitempty"`
+	OnSchedule bool   `protobuf:"varint,3,opt,name=OnSchedule,proto3" json:"OnSchedule,omitempty"`
+}
+
+func (m *IsAdActiveResponse) Reset()         { *m = IsAdActiveResponse{} }
+func (m *IsAdActiveResponse) String() string { return proto.CompactTextString(m) }
+func (*IsAdActiveResponse) ProtoMessage()    {}
+
+type adScheduleServiceServer interface {
+	IsAdActive(ctx context.Context, request *IsAdActiveRequest) (*IsAdActiveResponse, error)
+}
+
+var adScheduleServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ads.AdScheduleService",
+	HandlerType: (*adScheduleServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "IsAdActive",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(IsAdActiveRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(adScheduleServiceServer).IsAdActive(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: "/ads.AdScheduleService/IsAdActive",
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(adScheduleServiceServer).IsAdActive(ctx, req.(*IsAdActiveRequest))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+	},
+	Metadata: "ads_schedule_service.proto",
+}
+
+func RegisterAdScheduleServiceServer(s *grpc.Server, srv *gRPCAdsService) {
+	s.RegisterService(&adScheduleServiceDesc, srv)
+}
+
+// IsAdActive tells whether a promoted tweet should be shown at the requested time.
+func (s *gRPCAdsService) IsAdActive(ctx context.Context, request *IsAdActiveRequest) (*IsAdActiveResponse, error) {
+	serviceCtx, span := s.tracer.Start(ctx, "gRPCAdsService.IsAdActive")
+	defer span.End()
+
+	_, err := gocql.ParseUUID(request.TweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, status.Error(grpcCodes.InvalidArgument, err.Error())
+	}
+
+	at := time.Now()
+	if request.At != "" {
+		at, err = time.Parse(time.RFC3339, request.At)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, status.Error(grpcCodes.InvalidArgument, "At must be an RFC 3339 time")
+		}
+	}
+
+	adInfo, err := lookupAd(serviceCtx, s.eventsRepository, request.TweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if adInfo == nil {
+		span.SetStatus(codes.Error, "Ad not found")
+		return nil, status.Error(grpcCodes.NotFound, "Ad not found")
+	}
+
+	active, adStatus, scheduled, err := adActivityAt(serviceCtx, s.eventsRepository, adInfo, at)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return &IsAdActiveResponse{
+		Active:     active,
+		Status:     adStatus,
+		OnSchedule: scheduled,
+	}, nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/gocql/gocql"
+	"time"
+)
+
+const maxBatchEvents = 500
+
+// batchItem is one event on its way through ingestion, it's done once result has a status.
+type batchItem struct {
+	event      model.ReportEvent
+	tweetId    gocql.UUID
+	eventKey   string
+	occurredAt time.Time
+	result     *model.BatchEventResult
+	// cause is the error the event failed with, when there is one
+	cause error
+}
+
+func (i *batchItem) fail(status int, message string, cause error) {
+	i.result.Status = status
+	i.result.Error = message
+	i.cause = cause
+}
+
+// ingestEvent runs a single event through ingestBatch, event has its kind and the fields of that kind set. It
+// returns the item with its result, so callers can report the cause of a failure.
+func ingestEvent(ctx context.Context, eventsRepository repository.EventsRepository, aggregator *ReportAggregator, tweetId gocql.UUID, event model.ReportEvent, eventKey string, occurredAt time.Time, demographics func(username string) (model.Demographics, error)) *batchItem {
+	item := &batchItem{
+		event:      event,
+		tweetId:    tweetId,
+		eventKey:   eventKey,
+		occurredAt: occurredAt,
+		result:     &model.BatchEventResult{},
+	}
+
+	ingestBatch(ctx, eventsRepository, aggregator, []*batchItem{item}, demographics)
+
+	return item
+}
+
+// ingestBatch stores and enqueues the events of a batch that are still pending and records the outcome of each one in
+// its result. Every ingestion path runs its events through here, single events as a batch of one. An event's ad is
+// looked up, its time checked and its key claimed, then it's stored, attributed, given its audience and enqueued, and
+// a failure after the claim releases the key so a retry goes through. demographics resolves the audience of a user,
+// events of users it fails for are counted with an unknown audience since they're already stored.
+func ingestBatch(ctx context.Context, eventsRepository repository.EventsRepository, aggregator *ReportAggregator, items []*batchItem, demographics func(username string) (model.Demographics, error)) {
+	ads := map[string]*model.AdInfo{}
+
+	var claimed []*batchItem
+	for _, item := range items {
+		if item.result.Status != 0 {
+			continue
+		}
+
+		adInfo, ok := ads[item.event.TweetId]
+		if !ok {
+			var err error
+			adInfo, err = lookupAd(ctx, eventsRepository, item.event.TweetId)
+			if err != nil {
+				item.fail(500, "", err)
+				continue
+			}
+			ads[item.event.TweetId] = adInfo
+		}
+
+		occurredAt, late, err := eventTime(item.occurredAt, adLocation(adInfo))
+		if err != nil {
+			item.fail(422, err.Error(), err)
+			continue
+		}
+
+		inactive, err := checkAdActive(ctx, eventsRepository, adInfo, occurredAt)
+		if err == ErrAdNotActive {
+			item.fail(409, "Ad isn't active", err)
+			continue
+		}
+		if err != nil {
+			item.fail(500, "", err)
+			continue
+		}
+
+		isNew, err := claimEvent(ctx, eventsRepository, item.tweetId, item.event.Kind, item.event.Username, item.eventKey)
+		if err != nil {
+			item.fail(500, "", err)
+			continue
+		}
+
+		if !isNew {
+			item.result.Status = 200
+			item.result.Duplicate = true
+			continue
+		}
+
+		item.occurredAt = occurredAt
+		item.event.Time = reportEventTime(occurredAt, late)
+		item.event.Late = late
+		item.event.Inactive = inactive
+		claimed = append(claimed, item)
+	}
+
+	if len(claimed) == 0 {
+		return
+	}
+
+	// raw events are stored at the time they're counted at, late ones when they arrived
+	events := make([]model.ReportEvent, len(claimed))
+	for i, item := range claimed {
+		events[i] = item.event
+	}
+
+	errs := eventsRepository.SaveEvents(ctx, events)
+
+	for i, item := range claimed {
+		if errs[i] != nil {
+			releaseEvent(ctx, eventsRepository, item.tweetId, item.event.Kind, item.event.Username, item.eventKey)
+			item.fail(500, "", errs[i])
+			continue
+		}
+
+		err := attributeEvent(ctx, eventsRepository, item.tweetId, &item.event, item.occurredAt)
+		if err != nil {
+			releaseEvent(ctx, eventsRepository, item.tweetId, item.event.Kind, item.event.Username, item.eventKey)
+			item.fail(500, "", err)
+			continue
+		}
+
+		if item.event.Kind != model.UNLIKE_EVENT {
+			d, err := demographics(item.event.Username)
+			if err != nil {
+				d = model.Demographics{}
+			}
+			item.event.Segment = audienceSegment(ads[item.event.TweetId], d)
+		}
+
+		err = aggregator.Enqueue(ctx, item.event)
+		if err != nil {
+			releaseEvent(ctx, eventsRepository, item.tweetId, item.event.Kind, item.event.Username, item.eventKey)
+			item.fail(503, "", err)
+			continue
+		}
+
+		item.result.Status = 200
+	}
+}
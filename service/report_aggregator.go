@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultAggregatorWorkers       = 4
+	defaultAggregatorBatchSize     = 500
+	defaultAggregatorQueueSize     = 10000
+	defaultAggregatorFlushInterval = time.Second
+	defaultAggregatorEnqueueWait   = 5 * time.Second
+)
+
+var ErrAggregatorBusy = errors.New("report aggregation queue is full")
+
+// ReportAggregator counts events in reports off the request path. Ingestion only persists the raw event and
+// enqueues it, a pool of workers batches the queue and applies every batch with one bulk write.
+// Events still queued when the process dies are lost from reports, they stay in Cassandra and can be recounted.
+// Batches that can't be written are recorded as dead letters by month, they're recounted in the background every
+// DEAD_LETTER_REBUILD_INTERVAL or by rebuild-reports --dead-letters.
+type ReportAggregator struct {
+	reportsRepository repository.ReportsRepository
+	tracer            trace.Tracer
+	queue             chan model.ReportEvent
+	batchSize         int
+	flushInterval     time.Duration
+	enqueueWait       time.Duration
+	wg                sync.WaitGroup
+	mu                sync.RWMutex
+	stopped           bool
+	processed         int64
+	failed            int64
+	deadLettered      int64
+	lagMillis         int64
+	maxLagMillis      int64
+}
+
+func NewReportAggregator(reportsRepository repository.ReportsRepository, tracer trace.Tracer) *ReportAggregator {
+	a := &ReportAggregator{
+		reportsRepository: reportsRepository,
+		tracer:            tracer,
+		queue:             make(chan model.ReportEvent, envInt("REPORT_AGGREGATOR_QUEUE_SIZE", defaultAggregatorQueueSize)),
+		batchSize:         envInt("REPORT_AGGREGATOR_BATCH_SIZE", defaultAggregatorBatchSize),
+		flushInterval:     envDuration("REPORT_AGGREGATOR_FLUSH_INTERVAL", defaultAggregatorFlushInterval),
+		enqueueWait:       envDuration("REPORT_AGGREGATOR_ENQUEUE_WAIT", defaultAggregatorEnqueueWait),
+	}
+
+	workers := envInt("REPORT_AGGREGATOR_WORKERS", defaultAggregatorWorkers)
+	for i := 0; i < workers; i++ {
+		a.wg.Add(1)
+		go a.work()
+	}
+
+	return a
+}
+
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+
+	return value
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+
+	return value
+}
+
+// Enqueue waits for room in the queue while the request is alive, for REPORT_AGGREGATOR_ENQUEUE_WAIT at most.
+// Events enqueued after Stop are refused like those that find the queue full.
+func (a *ReportAggregator) Enqueue(ctx context.Context, e model.ReportEvent) error {
+	e.EnqueuedAt = time.Now()
+
+	// held while sending, so the queue isn't closed under a waiting request
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.stopped {
+		return ErrAggregatorBusy
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.enqueueWait)
+	defer cancel()
+
+	select {
+	case a.queue <- e:
+		return nil
+	case <-ctx.Done():
+		return ErrAggregatorBusy
+	}
+}
+
+// Stop stops accepting events and waits until the queued ones are applied. Requests still running can keep calling
+// Enqueue, their events are refused.
+func (a *ReportAggregator) Stop() {
+	a.mu.Lock()
+	a.stopped = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	a.wg.Wait()
+}
+
+func (a *ReportAggregator) Stats() model.AggregatorStats {
+	return model.AggregatorStats{
+		Queued:        len(a.queue),
+		QueueCapacity: cap(a.queue),
+		Processed:     atomic.LoadInt64(&a.processed),
+		Failed:        atomic.LoadInt64(&a.failed),
+		DeadLettered:  atomic.LoadInt64(&a.deadLettered),
+		LagMillis:     atomic.LoadInt64(&a.lagMillis),
+		MaxLagMillis:  atomic.LoadInt64(&a.maxLagMillis),
+	}
+}
+
+func (a *ReportAggregator) work() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]model.ReportEvent, 0, a.batchSize)
+
+	for {
+		select {
+		case e, ok := <-a.queue:
+			if !ok {
+				a.flush(batch)
+				return
+			}
+
+			batch = append(batch, e)
+			if len(batch) >= a.batchSize {
+				a.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			a.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (a *ReportAggregator) flush(batch []model.ReportEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, span := a.tracer.Start(context.Background(), "ReportAggregator.flush")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch.size", len(batch)))
+
+	err := a.reportsRepository.ApplyReportEvents(ctx, batch)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		atomic.AddInt64(&a.failed, int64(len(batch)))
+		a.deadLetter(ctx, batch, err)
+		return
+	}
+
+	atomic.AddInt64(&a.processed, int64(len(batch)))
+
+	// lag of the oldest event in the batch, it waited the longest
+	lag := time.Since(batch[0].EnqueuedAt).Milliseconds()
+	atomic.StoreInt64(&a.lagMillis, lag)
+	for {
+		max := atomic.LoadInt64(&a.maxLagMillis)
+		if lag <= max || atomic.CompareAndSwapInt64(&a.maxLagMillis, max, lag) {
+			break
+		}
+	}
+}
+
+// deadLetter records the months a failed batch belonged to. Part of the batch may have been written, so its events
+// aren't retried on their own, their months are recounted from the event store instead.
+func (a *ReportAggregator) deadLetter(ctx context.Context, batch []model.ReportEvent, cause error) {
+	type month struct {
+		tweetId string
+		year    int64
+		month   int64
+	}
+
+	counts := map[month]int{}
+	var months []month
+	for _, e := range batch {
+		m := month{e.TweetId, int64(e.Time.Year()), int64(e.Time.Month())}
+		if counts[m] == 0 {
+			months = append(months, m)
+		}
+		counts[m]++
+	}
+
+	failedAt := time.Now()
+	letters := make([]model.DeadLetter, len(months))
+	for i, m := range months {
+		letters[i] = model.DeadLetter{
+			TweetId:  m.tweetId,
+			Year:     m.year,
+			Month:    m.month,
+			Events:   counts[m],
+			FailedAt: failedAt,
+			Error:    cause.Error(),
+		}
+	}
+
+	err := a.reportsRepository.SaveDeadLetters(ctx, letters)
+	if err != nil {
+		for _, l := range letters {
+			log.Printf("Dropped %d report events of tweet %s in %04d-%02d, rebuild the month: %s", l.Events, l.TweetId, l.Year, l.Month, cause.Error())
+		}
+		return
+	}
+
+	atomic.AddInt64(&a.deadLettered, int64(len(batch)))
+	log.Printf("Dead lettered %d report events in %d months: %s", len(batch), len(letters), cause.Error())
+}
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"github.com/FTN-TwitterClone/ads/model"
+	"time"
+)
+
+// reportWindow returns the span of time a stored report covers in loc.
+func reportWindow(key model.ReportKey, loc *time.Location) (time.Time, time.Time) {
+	switch key.Type {
+	case model.HOURLY:
+		start := time.Date(int(key.Year), time.Month(key.Month), int(key.Day), int(key.Hour), 0, 0, 0, loc)
+		return start, start.Add(time.Hour)
+	case model.DAILY:
+		start := time.Date(int(key.Year), time.Month(key.Month), int(key.Day), 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 1)
+	default:
+		start := time.Date(int(key.Year), time.Month(key.Month), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	}
+}
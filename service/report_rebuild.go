@@ -0,0 +1,398 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	rebuildBatchSize                 = 1000
+	defaultDeadLetterRebuildInterval = 5 * time.Minute
+)
+
+type RebuildOptions struct {
+	// TweetId limits the rebuild to one ad, every ad is rebuilt when it's empty
+	TweetId string
+	From    time.Time
+	To      time.Time
+	DryRun  bool
+	Out     io.Writer
+}
+
+// RebuildReports recounts the reports of whole months from the events stored in Cassandra. Every month touched by
+// [From, To] in the ad's timezone is deleted and counted again, so running it twice gives the same reports.
+// Events ingested for a month while it's being rebuilt can be lost or counted twice, rebuild the current month with
+// ingestion stopped. Audience is counted with the viewers' latest known demographics and is on target for the
+// targeting the ad had when each event happened.
+func RebuildReports(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, opts RebuildOptions) error {
+	serviceCtx, span := tracer.Start(ctx, "RebuildReports")
+	defer span.End()
+
+	tweetIds := []string{opts.TweetId}
+	if opts.TweetId == "" {
+		var err error
+		tweetIds, err = eventsRepository.GetAdTweetIds(serviceCtx)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
+
+	demographics := map[string]model.Demographics{}
+
+	for i, tweetId := range tweetIds {
+		uuid, err := gocql.ParseUUID(tweetId)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		adInfo, err := lookupAd(serviceCtx, eventsRepository, tweetId)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		history, err := eventsRepository.GetAdStatusHistory(serviceCtx, tweetId)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		targetingHistory, err := eventsRepository.GetAdTargetingHistory(serviceCtx, tweetId)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		loc := adLocation(adInfo)
+		from := inLocation(opts.From, loc)
+		to := inLocation(opts.To, loc)
+
+		fmt.Fprintf(opts.Out, "[%d/%d] tweet %s\n", i+1, len(tweetIds), tweetId)
+
+		for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, loc); !month.After(to); month = month.AddDate(0, 1, 0) {
+			events, err := attributedTweetEvents(serviceCtx, eventsRepository, uuid, month, month.AddDate(0, 1, 0))
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+
+			markInactiveEvents(events, history)
+
+			for j := range events {
+				events[j].Time = events[j].Time.In(loc)
+
+				if events[j].Kind == model.UNLIKE_EVENT {
+					continue
+				}
+
+				d, ok := demographics[events[j].Username]
+				if !ok {
+					found, err := eventsRepository.GetViewerDemographics(serviceCtx, events[j].Username)
+					if err != nil {
+						span.SetStatus(codes.Error, err.Error())
+						return err
+					}
+					d = *found
+					demographics[events[j].Username] = d
+				}
+				events[j].Segment = audienceSegment(targetingAt(adInfo, targetingHistory, events[j].Time), d)
+			}
+
+			fmt.Fprintf(opts.Out, "  %04d-%02d: %d events\n", month.Year(), month.Month(), len(events))
+
+			if opts.DryRun {
+				err = printRebuildDiff(serviceCtx, reportsRepository, opts.Out, tweetId, month, events)
+			} else {
+				err = replaceMonthReports(serviceCtx, reportsRepository, tweetId, month, events)
+			}
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// a dead lettered month is held by one replica for this long while it's rebuilt
+const deadLetterClaim = 30 * time.Minute
+
+// StartDeadLetterRebuilds recounts the months the aggregator couldn't write events to every interval until ctx is
+// done. Months are claimed before they're rebuilt, so it can run on every replica.
+func StartDeadLetterRebuilds(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := RebuildDeadLetters(ctx, tracer, eventsRepository, reportsRepository, false, io.Discard)
+			if err != nil {
+				log.Printf("dead letter rebuild failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// DeadLetterRebuildIntervalFromEnv configures the background dead letter rebuild, DEAD_LETTER_REBUILD_INTERVAL=0
+// turns it off.
+func DeadLetterRebuildIntervalFromEnv() time.Duration {
+	value := os.Getenv("DEAD_LETTER_REBUILD_INTERVAL")
+	if value == "" {
+		return defaultDeadLetterRebuildInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		return 0
+	}
+
+	return interval
+}
+
+// RebuildDeadLetters recounts the months the aggregator couldn't write events to, a month is cleared once it's rebuilt.
+// A month another replica is rebuilding is skipped. Like any rebuild of the current month, events ingested while it
+// runs can be lost or counted twice, the reconciler finds those days.
+func RebuildDeadLetters(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, dryRun bool, out io.Writer) error {
+	serviceCtx, span := tracer.Start(ctx, "RebuildDeadLetters")
+	defer span.End()
+
+	letters, err := reportsRepository.GetDeadLetters(serviceCtx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	fmt.Fprintf(out, "%d dead lettered months\n", len(letters))
+
+	for i := range letters {
+		l := &letters[i]
+		month := time.Date(int(l.Year), time.Month(l.Month), 1, 0, 0, 0, 0, time.UTC)
+
+		if !dryRun {
+			claimed, err := reportsRepository.ClaimDeadLetter(serviceCtx, l, time.Now().Add(deadLetterClaim))
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+			if !claimed {
+				fmt.Fprintf(out, "tweet %s %04d-%02d is being rebuilt elsewhere\n", l.TweetId, l.Year, l.Month)
+				continue
+			}
+		}
+
+		err = RebuildReports(serviceCtx, tracer, eventsRepository, reportsRepository, RebuildOptions{
+			TweetId: l.TweetId,
+			From:    month,
+			To:      month,
+			DryRun:  dryRun,
+			Out:     out,
+		})
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		if dryRun {
+			continue
+		}
+
+		err = reportsRepository.DeleteDeadLetter(serviceCtx, l)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attributedTweetEvents reads the events of a tweet in [from, to) with their conversions attributed, reading further
+// back as far as attribution reaches.
+func attributedTweetEvents(ctx context.Context, eventsRepository repository.EventsRepository, tweetId gocql.UUID, from time.Time, to time.Time) ([]model.ReportEvent, error) {
+	events, err := eventsRepository.GetTweetEvents(ctx, tweetId, from.Add(-attributionLookback()), to)
+	if err != nil {
+		return nil, err
+	}
+
+	attributeEvents(events)
+
+	inRange := events[:0]
+	for _, e := range events {
+		if !e.Time.Before(from) {
+			inRange = append(inRange, e)
+		}
+	}
+
+	return inRange, nil
+}
+
+func replaceMonthReports(ctx context.Context, reportsRepository repository.ReportsRepository, tweetId string, month time.Time, events []model.ReportEvent) error {
+	err := reportsRepository.DeleteMonthReports(ctx, tweetId, int64(month.Year()), int64(month.Month()))
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(events); start += rebuildBatchSize {
+		end := start + rebuildBatchSize
+		if end > len(events) {
+			end = len(events)
+		}
+
+		err = reportsRepository.ApplyReportEvents(ctx, events[start:end])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printRebuildDiff writes the counters a rebuild would change without changing them.
+func printRebuildDiff(ctx context.Context, reportsRepository repository.ReportsRepository, out io.Writer, tweetId string, month time.Time, events []model.ReportEvent) error {
+	year, m := int64(month.Year()), int64(month.Month())
+
+	rebuiltMonth := model.Report{}
+	rebuiltDays := map[int64]*model.Report{}
+
+	for _, e := range events {
+		day, ok := rebuiltDays[int64(e.Time.Day())]
+		if !ok {
+			day = &model.Report{}
+			rebuiltDays[int64(e.Time.Day())] = day
+		}
+		countEvent(&rebuiltMonth, e)
+		countEvent(day, e)
+	}
+
+	current, err := reportsRepository.GetMonthlyReport(ctx, tweetId, year, m)
+	if err != nil {
+		return err
+	}
+	printReportDiff(out, fmt.Sprintf("%04d-%02d", year, m), current, &rebuiltMonth)
+
+	for day := month; day.Month() == month.Month(); day = day.AddDate(0, 0, 1) {
+		current, err := reportsRepository.GetDailyReport(ctx, tweetId, year, m, int64(day.Day()))
+		if err != nil {
+			return err
+		}
+
+		rebuilt, ok := rebuiltDays[int64(day.Day())]
+		if !ok {
+			rebuilt = &model.Report{}
+		}
+		printReportDiff(out, fmt.Sprintf("%04d-%02d-%02d", year, m, day.Day()), current, rebuilt)
+	}
+
+	return nil
+}
+
+func countEvent(r *model.Report, e model.ReportEvent) {
+	if e.Late {
+		r.LateEvents++
+		return
+	}
+
+	if e.Inactive {
+		r.InactiveEvents++
+		return
+	}
+
+	if isConversion(e.Kind) {
+		if e.Attributed {
+			r.AttributedConversions++
+		} else {
+			r.OrganicConversions++
+		}
+	}
+
+	switch e.Kind {
+	case model.LIKE_EVENT:
+		r.LikesCount++
+	case model.UNLIKE_EVENT:
+		r.UnlikesCount++
+	case model.VISIT_EVENT:
+		r.ProfileVisits++
+	case model.VIEW_EVENT:
+		r.Impressions++
+		r.ViewCount++
+		r.ViewTimeSum += e.ViewTime
+	case model.CLICK_EVENT:
+		r.Clicks++
+		switch e.ClickType {
+		case model.LINK_CLICK:
+			r.LinkClicks++
+		case model.MEDIA_CLICK:
+			r.MediaClicks++
+		case model.HASHTAG_CLICK:
+			r.HashtagClicks++
+		}
+	case model.CONVERSION_EVENT:
+		r.Conversions++
+		switch e.ConversionType {
+		case model.RETWEET_CONVERSION:
+			r.Retweets++
+		case model.REPLY_CONVERSION:
+			r.Replies++
+		case model.FOLLOW_CONVERSION:
+			r.Follows++
+		}
+	}
+}
+
+// reportCounters are the report fields that can be recounted from raw events.
+var reportCounters = []struct {
+	name  string
+	value func(r *model.Report) int64
+}{
+	{"likes", func(r *model.Report) int64 { return int64(r.LikesCount) }},
+	{"unlikes", func(r *model.Report) int64 { return int64(r.UnlikesCount) }},
+	{"visits", func(r *model.Report) int64 { return int64(r.ProfileVisits) }},
+	{"impressions", func(r *model.Report) int64 { return int64(r.Impressions) }},
+	{"viewCount", func(r *model.Report) int64 { return int64(r.ViewCount) }},
+	{"viewTimeSum", func(r *model.Report) int64 { return r.ViewTimeSum }},
+	{"clicks", func(r *model.Report) int64 { return int64(r.Clicks) }},
+	{"linkClicks", func(r *model.Report) int64 { return int64(r.LinkClicks) }},
+	{"mediaClicks", func(r *model.Report) int64 { return int64(r.MediaClicks) }},
+	{"hashtagClicks", func(r *model.Report) int64 { return int64(r.HashtagClicks) }},
+	{"conversions", func(r *model.Report) int64 { return int64(r.Conversions) }},
+	{"retweets", func(r *model.Report) int64 { return int64(r.Retweets) }},
+	{"replies", func(r *model.Report) int64 { return int64(r.Replies) }},
+	{"follows", func(r *model.Report) int64 { return int64(r.Follows) }},
+	{"lateEvents", func(r *model.Report) int64 { return int64(r.LateEvents) }},
+	{"inactiveEvents", func(r *model.Report) int64 { return int64(r.InactiveEvents) }},
+	{"attributedConversions", func(r *model.Report) int64 { return int64(r.AttributedConversions) }},
+	{"organicConversions", func(r *model.Report) int64 { return int64(r.OrganicConversions) }},
+}
+
+func printReportDiff(out io.Writer, period string, current *model.Report, rebuilt *model.Report) {
+	if current == nil {
+		current = &model.Report{}
+	}
+
+	var changes []string
+	for _, c := range reportCounters {
+		if c.value(current) != c.value(rebuilt) {
+			changes = append(changes, fmt.Sprintf("%s %d -> %d", c.name, c.value(current), c.value(rebuilt)))
+		}
+	}
+
+	if len(changes) > 0 {
+		fmt.Fprintf(out, "    %s: %s\n", period, strings.Join(changes, ", "))
+	}
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"github.com/FTN-TwitterClone/ads/model"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReconcileSample = 20
+	defaultReconcileDays   = 7
+	maxReportedDrifts      = 100
+)
+
+type ReconcileOptions struct {
+	// TweetId checks one ad instead of a random sample
+	TweetId string
+	Sample  int
+	Days    int
+	Repair  bool
+}
+
+// ReportReconciler compares daily report counters with the events stored in Cassandra and optionally repairs them.
+// Only whole days that ended before the lateness cutoff are checked, events of later days can still arrive and be
+// counted.
+// Sketches, histograms and audience breakdowns aren't checked and hourly reports aren't repaired, rebuild-reports
+// recounts those. A report is only repaired if it didn't change since it was checked, so the reconciler can run on
+// every replica.
+type ReportReconciler struct {
+	eventsRepository  repository.EventsRepository
+	reportsRepository repository.ReportsRepository
+	tracer            trace.Tracer
+	opts              ReconcileOptions
+	mu                sync.Mutex
+	stats             model.ReconciliationStats
+}
+
+func NewReportReconciler(eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, tracer trace.Tracer, opts ReconcileOptions) *ReportReconciler {
+	if opts.Sample <= 0 {
+		opts.Sample = defaultReconcileSample
+	}
+	if opts.Days <= 0 {
+		opts.Days = defaultReconcileDays
+	}
+
+	return &ReportReconciler{
+		eventsRepository:  eventsRepository,
+		reportsRepository: reportsRepository,
+		tracer:            tracer,
+		opts:              opts,
+	}
+}
+
+// ReconcileOptionsFromEnv configures the background reconciler, it's off unless RECONCILE_INTERVAL is set.
+func ReconcileOptionsFromEnv() (ReconcileOptions, time.Duration) {
+	opts := ReconcileOptions{
+		Sample: envInt("RECONCILE_SAMPLE_SIZE", defaultReconcileSample),
+		Days:   envInt("RECONCILE_DAYS", defaultReconcileDays),
+		Repair: os.Getenv("RECONCILE_REPAIR") == "true",
+	}
+
+	interval, err := time.ParseDuration(os.Getenv("RECONCILE_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return opts, 0
+	}
+
+	return opts, interval
+}
+
+// Start runs a reconciliation every interval until ctx is done.
+func (r *ReportReconciler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := r.Run(ctx)
+			if err != nil {
+				log.Printf("report reconciliation failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *ReportReconciler) Stats() model.ReconciliationStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.stats
+}
+
+// Run checks the sampled ads once and returns what it found, ads that fail to be checked are logged and counted.
+func (r *ReportReconciler) Run(ctx context.Context) (*model.ReconciliationStats, error) {
+	serviceCtx, span := r.tracer.Start(ctx, "ReportReconciler.Run")
+	defer span.End()
+
+	tweetIds, err := r.sampleAds(serviceCtx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	run := model.ReconciliationStats{LastRunAt: time.Now(), AdsChecked: len(tweetIds)}
+
+	// an ad that can't be checked doesn't stop the rest of the sample
+	for _, tweetId := range tweetIds {
+		err := r.reconcileAd(serviceCtx, tweetId, &run)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			log.Printf("report reconciliation of tweet %s failed: %v", tweetId, err)
+			run.FailedAds++
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int("ads.failed", run.FailedAds),
+		attribute.Int("reports.checked", run.ReportsChecked),
+		attribute.Int("reports.drifted", run.DriftedReports),
+		attribute.Int64("drift.total", run.TotalDrift),
+	)
+
+	if run.DriftedReports > 0 {
+		log.Printf("report reconciliation: %d of %d daily reports drifted by %d in total, %d repaired", run.DriftedReports, run.ReportsChecked, run.TotalDrift, run.RepairedReports)
+	}
+
+	r.mu.Lock()
+	run.Runs = r.stats.Runs + 1
+	run.DriftedReportsTotal = r.stats.DriftedReportsTotal + int64(run.DriftedReports)
+	r.stats = run
+	r.mu.Unlock()
+
+	return &run, nil
+}
+
+func (r *ReportReconciler) sampleAds(ctx context.Context) ([]string, error) {
+	if r.opts.TweetId != "" {
+		return []string{r.opts.TweetId}, nil
+	}
+
+	tweetIds, err := r.eventsRepository.GetAdTweetIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rand.Shuffle(len(tweetIds), func(i, j int) {
+		tweetIds[i], tweetIds[j] = tweetIds[j], tweetIds[i]
+	})
+
+	if len(tweetIds) > r.opts.Sample {
+		tweetIds = tweetIds[:r.opts.Sample]
+	}
+
+	return tweetIds, nil
+}
+
+func (r *ReportReconciler) reconcileAd(ctx context.Context, tweetId string, run *model.ReconciliationStats) error {
+	uuid, err := gocql.ParseUUID(tweetId)
+	if err != nil {
+		return err
+	}
+
+	adInfo, err := lookupAd(ctx, r.eventsRepository, tweetId)
+	if err != nil {
+		return err
+	}
+
+	loc := adLocation(adInfo)
+	settled := time.Now().Add(-latenessCutoff).In(loc)
+	to := time.Date(settled.Year(), settled.Month(), settled.Day(), 0, 0, 0, 0, loc)
+	from := to.AddDate(0, 0, -r.opts.Days)
+
+	events, err := attributedTweetEvents(ctx, r.eventsRepository, uuid, from, to)
+	if err != nil {
+		return err
+	}
+
+	history, err := r.eventsRepository.GetAdStatusHistory(ctx, tweetId)
+	if err != nil {
+		return err
+	}
+
+	markInactiveEvents(events, history)
+
+	counted := map[time.Time]*model.Report{}
+	for _, e := range events {
+		t := e.Time.In(loc)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		if counted[day] == nil {
+			counted[day] = &model.Report{}
+		}
+		countEvent(counted[day], e)
+	}
+
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		year, month, d := int64(day.Year()), int64(day.Month()), int64(day.Day())
+
+		reported, err := r.reportsRepository.GetDailyReport(ctx, tweetId, year, month, d)
+		if err != nil {
+			return err
+		}
+		if reported == nil {
+			reported = &model.Report{}
+		}
+
+		expected := counted[day]
+		if expected == nil {
+			expected = &model.Report{}
+		}
+
+		run.ReportsChecked++
+
+		drifted := false
+		for _, c := range reportCounters {
+			if c.value(reported) == c.value(expected) {
+				continue
+			}
+
+			drifted = true
+			diff := c.value(expected) - c.value(reported)
+			if diff < 0 {
+				diff = -diff
+			}
+			run.TotalDrift += diff
+
+			if len(run.Drifts) < maxReportedDrifts {
+				run.Drifts = append(run.Drifts, model.ReportDrift{
+					TweetId:  tweetId,
+					Year:     year,
+					Month:    month,
+					Day:      d,
+					Counter:  c.name,
+					Reported: c.value(reported),
+					Counted:  c.value(expected),
+				})
+			}
+		}
+
+		if !drifted {
+			continue
+		}
+
+		run.DriftedReports++
+
+		if r.opts.Repair {
+			repaired, err := r.reportsRepository.RepairReportCounters(ctx, tweetId, year, month, d, reported, expected)
+			if err != nil {
+				return err
+			}
+
+			if repaired {
+				run.RepairedReports++
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"github.com/FTN-TwitterClone/ads/model"
+	"log"
+	"os"
+	"time"
+)
+
+// Zone used for ads without their own timezone, REPORTS_TIMEZONE or the server's local zone when it is not set
+var defaultLocation = loadDefaultLocation()
+
+func loadDefaultLocation() *time.Location {
+	name := os.Getenv("REPORTS_TIMEZONE")
+	if name == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Fatalf("invalid REPORTS_TIMEZONE: %v", err)
+	}
+
+	return loc
+}
+
+// adLocation returns the zone reports of an ad are bucketed in, tweets that aren't ads use the default zone.
+func adLocation(adInfo *model.AdInfo) *time.Location {
+	if adInfo == nil || adInfo.Timezone == "" {
+		return defaultLocation
+	}
+
+	loc, err := time.LoadLocation(adInfo.Timezone)
+	if err != nil {
+		return defaultLocation
+	}
+
+	return loc
+}
+
+// inLocation moves the calendar date of t to midnight in loc.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"time"
+)
+
+// BackfillTouchpoints records the views, clicks and likes stored before viewer_touchpoints existed as touchpoints, so
+// conversions ingested afterwards are credited to contact that's still within its window. Only the latest touchpoint
+// of each kind per viewer is kept, it's the one that reaches furthest, and running it again rewrites the same ones.
+func BackfillTouchpoints(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository) error {
+	serviceCtx, span := tracer.Start(ctx, "BackfillTouchpoints")
+	defer span.End()
+
+	tweetIds, err := eventsRepository.GetAdTweetIds(serviceCtx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	now := time.Now()
+	count := 0
+
+	for i, tweetId := range tweetIds {
+		uuid, err := gocql.ParseUUID(tweetId)
+		if err != nil {
+			log.Printf("skipping ad with invalid tweet id %s", tweetId)
+			continue
+		}
+
+		events, err := eventsRepository.GetTweetEvents(serviceCtx, uuid, now.Add(-attributionLookback()), now)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		type touchpoint struct {
+			username string
+			kind     string
+		}
+
+		latest := map[touchpoint]time.Time{}
+		for _, e := range events {
+			kind := touchpointKind(e.Kind)
+			// late events are stored at when they arrived, they aren't touchpoints
+			if kind == "" || e.Late {
+				continue
+			}
+
+			t := touchpoint{e.Username, kind}
+			if e.Time.After(latest[t]) {
+				latest[t] = e.Time
+			}
+		}
+
+		for t, at := range latest {
+			ttl := at.Add(touchpointWindow(t.kind)).Sub(now)
+			if ttl < time.Second {
+				continue
+			}
+
+			err = eventsRepository.SaveTouchpoint(serviceCtx, uuid, t.username, t.kind, at, ttl)
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+			count++
+		}
+
+		if (i+1)%100 == 0 {
+			log.Printf("backfilled touchpoints of %d/%d ads", i+1, len(tweetIds))
+		}
+	}
+
+	log.Printf("backfilled %d touchpoints of %d ads", count, len(tweetIds))
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"github.com/FTN-TwitterClone/ads/repository"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"time"
+)
+
+// BackfillViewTimeTotals fills in the view time sum and count of reports written while only the average was stored.
+// Only events before cutoff, when the first instance started counting totals itself, are added so nothing is counted
+// twice. Views taken by instances still running the old code after cutoff aren't in the totals, reconcile-reports
+// --repair recounts the days of the deploy.
+func BackfillViewTimeTotals(ctx context.Context, tracer trace.Tracer, eventsRepository repository.EventsRepository, reportsRepository repository.ReportsRepository, cutoff time.Time) error {
+	serviceCtx, span := tracer.Start(ctx, "BackfillViewTimeTotals")
+	defer span.End()
+
+	keys, err := reportsRepository.GetReportKeysWithoutViewTimeTotals(serviceCtx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	log.Printf("backfilling view time totals of %d reports", len(keys))
+
+	for i, key := range keys {
+		uuid, err := gocql.ParseUUID(key.TweetId)
+		if err != nil {
+			log.Printf("skipping report of invalid tweet id %s", key.TweetId)
+			continue
+		}
+
+		adInfo, err := lookupAd(serviceCtx, eventsRepository, key.TweetId)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		from, to := reportWindow(key, adLocation(adInfo))
+		if to.After(cutoff) {
+			to = cutoff
+		}
+
+		viewTimeSum, viewCount, err := eventsRepository.GetTweetViewTimeTotals(serviceCtx, uuid, from, to)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		err = reportsRepository.BackfillReportViewTimeTotals(serviceCtx, key, viewTimeSum, viewCount)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+
+		if (i+1)%1000 == 0 {
+			log.Printf("backfilled view time totals of %d/%d reports", i+1, len(keys))
+		}
+	}
+
+	log.Printf("backfilled view time totals of %d reports", len(keys))
+
+	return nil
+}